@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zerospiel/termin-prufen-go/pkg/prufen"
@@ -16,6 +18,20 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// singleRunDeliveryTimeout limits retries of notifications in the single run mode,
+// undelivered notifications are kept in the state dir for the next run.
+const singleRunDeliveryTimeout = time.Minute
+
+// Exit codes tell why the application has stopped, it exits with 0
+// once slots are found in the until found mode.
+const (
+	exitFailure  = 1
+	exitMaxRuns  = 2
+	exitDeadline = 3
+	// exitInterrupted is the conventional code of the SIGINT.
+	exitInterrupted = 130
+)
+
 func main() {
 	l := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		AddSource: true,
@@ -40,7 +56,7 @@ func main() {
 	cfg, err := getConfig()
 	if err != nil {
 		l.Error("failed to evaluate config", "error", err)
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
@@ -50,37 +66,155 @@ func main() {
 		TelegramAPIToken: cfg.TelegramBotToken,
 		TelegramChatID:   cfg.TelegramChatID,
 
-		Citizenship:             cfg.Citizenship,
-		PeopleNumber:            cfg.PeopleNumber,
-		LiveInBerlin:            cfg.LiveInBerlin,
-		FamilyMemberCitizenship: cfg.FamilyMemberCitizenship,
-		Reason:                  cfg.Reason,
+		TelegramAdminChatIDs: cfg.TelegramAdminChatIDs,
+		TelegramParseMode:    cfg.TelegramParseMode,
+		MessageTemplates:     cfg.MessageTemplates,
+
+		TelegramStatusMessage: cfg.TelegramStatusMessage,
+		TelegramWebhookURL:    cfg.TelegramWebhookURL,
+		TelegramWebhookSecret: cfg.TelegramWebhookSecret,
 
-		ScenarioTimeout:         cfg.ScenarioTimeout,
-		ScreenshotsPath:         cfg.ScreenshotsDir,
-		PollInterval:            cfg.PollInterval,
+		Subscriptions:         cfg.TelegramSubscriptions,
+		SubscribeCitizenships: cfg.SubscribeCitizenships,
+		MaxSubscribedProfiles: cfg.MaxSubscribedProfiles,
+
+		ScenarioTimeout: cfg.ScenarioTimeout,
+		ScreenshotsPath: cfg.ScreenshotsDir,
+		PollInterval:    cfg.PollInterval,
+		PollJitter:      cfg.PollJitter,
+		ErrorBackoff: prufen.ErrorBackoff{
+			MaxInterval:      cfg.ErrorBackoff.MaxInterval,
+			BreakerThreshold: cfg.ErrorBackoff.BreakerThreshold,
+			ProbeInterval:    cfg.ErrorBackoff.ProbeInterval,
+		},
+		OverlapPolicy: prufen.OverlapPolicy(cfg.OverlapPolicy),
+		Stop: prufen.StopConditions{
+			UntilFound: cfg.Stop.UntilFound,
+			MaxRuns:    cfg.Stop.MaxRuns,
+			Deadline:   cfg.Stop.Deadline,
+		},
+		Workers:                 cfg.Workers,
+		ReadinessRunWindow:      cfg.ReadinessRunWindow,
+		MaxRunsPerMinute:        cfg.MaxRunsPerMinute,
 		GracefulShutdownTimeout: cfg.GracefulShutdownTimeout,
 		Port:                    cfg.Port,
+		APIToken:                cfg.APIToken,
+		StateDir:                cfg.StateDir,
+
+		NotifyCooldown:        cfg.NotifyCooldown,
+		SlotsReminderInterval: cfg.SlotsReminderInterval,
 	}
 	if cfg.Debug {
 		options.DebugFunc = l.Debug
 	}
+	if cfg.AbhConfig != nil {
+		options.Citizenship = cfg.Citizenship
+		options.PeopleNumber = cfg.PeopleNumber
+		options.LiveInBerlin = cfg.LiveInBerlin
+		options.FamilyMemberCitizenship = cfg.FamilyMemberCitizenship
+		options.Reason = cfg.Reason
+		options.Service = cfg.Service
+	}
+	for key, svc := range cfg.Services {
+		if options.Services == nil {
+			options.Services = map[string]prufen.Service{}
+		}
+		options.Services[key] = prufen.Service{
+			Name:                svc.Name,
+			CategorySelector:    svc.CategorySelector,
+			ServiceSelector:     svc.ServiceSelector,
+			ApplicationSelector: svc.ApplicationSelector,
+			CategoriesSelector:  svc.CategoriesSelector,
+		}
+	}
+	for _, hook := range cfg.ExecHooks {
+		options.ExecHooks = append(options.ExecHooks, prufen.ExecHook{
+			Name:    hook.Name,
+			Command: hook.Command,
+			Timeout: hook.Timeout,
+			Kinds:   hook.Kinds,
+		})
+	}
+	options.TelegramRecipients = toRecipients(cfg.TelegramRecipients)
+	for _, step := range cfg.Escalation {
+		options.Escalation.Steps = append(options.Escalation.Steps, prufen.EscalationStep{
+			After:      step.After,
+			Recipients: toRecipients(step.Recipients),
+		})
+	}
+
+	if a := cfg.AdaptivePolling; a != nil {
+		options.AdaptivePolling = &prufen.AdaptivePolling{
+			MinInterval: a.MinInterval,
+			MaxInterval: a.MaxInterval,
+			BoostPeriod: a.BoostPeriod,
+			QuietPeriod: a.QuietPeriod,
+		}
+	}
+	if options.Schedule, err = toSchedule(cfg.Schedule); err != nil {
+		l.Error("invalid schedule", "error", err)
+		os.Exit(exitFailure)
+	}
+	if options.OfficeHours, err = toOfficeHours(cfg.OfficeHours); err != nil {
+		l.Error("invalid office hours", "error", err)
+		os.Exit(exitFailure)
+	}
+	for _, pc := range cfg.Profiles {
+		w := prufen.Watch{
+			Name: pc.Name,
+			Profile: prufen.Profile{
+				Citizenship:             pc.Citizenship,
+				PeopleNumber:            pc.PeopleNumber,
+				LiveInBerlin:            pc.LiveInBerlin,
+				FamilyMemberCitizenship: pc.FamilyMemberCitizenship,
+				Reason:                  pc.Reason,
+				Service:                 pc.Service,
+			},
+			PollInterval:       pc.PollInterval,
+			TelegramRecipients: toRecipients(pc.TelegramRecipients),
+		}
+		if w.Schedule, err = toSchedule(pc.Schedule); err != nil {
+			l.Error("invalid schedule", "profile", pc.Name, "error", err)
+			os.Exit(exitFailure)
+		}
+		options.Watches = append(options.Watches, w)
+	}
 
 	runner, err := prufen.NewRunner(options)
 	if err != nil {
 		l.Error("failed to init runner", "error", err)
-		return
+		os.Exit(exitFailure)
 	}
 
 	if cfg.SingleRunMode {
 		l.Info("Running in a single mode")
 		runner.RunFullCycle()
+
+		ctx, cancel := context.WithTimeout(ctx, singleRunDeliveryTimeout)
+		defer cancel()
+		if err := runner.DeliverPending(ctx); err != nil {
+			l.Error("failed to deliver notifications", "error", err)
+		}
 		return
 	}
 
-	if err := runner.Run(ctx); err != nil {
+	err = runner.Run(ctx)
+
+	var stopped *prufen.StoppedError
+	switch {
+	case errors.As(err, &stopped):
+		l.Info("stopped by the stop condition", "reason", stopped.Reason, "runs", stopped.Runs)
+		switch stopped.Reason {
+		case prufen.StopMaxRuns:
+			os.Exit(exitMaxRuns)
+		case prufen.StopDeadline:
+			os.Exit(exitDeadline)
+		}
+	case err != nil:
 		l.Error("failed to run, shutting down...", "error", err)
-		return
+		os.Exit(exitFailure)
+	case ctx.Err() != nil:
+		os.Exit(exitInterrupted)
 	}
 }
 
@@ -97,26 +231,247 @@ type (
 		LiveInBerlin            string `yaml:"live_in_berlin,omitempty"`
 		FamilyMemberCitizenship string `yaml:"family_member_citizenship,omitempty"`
 		Reason                  string `yaml:"reason,omitempty"`
+		Service                 string `yaml:"service,omitempty"`
+	}
+
+	// ProfileConfig is an additional profile watched on its own.
+	ProfileConfig struct {
+		Name      string `yaml:"name"`
+		AbhConfig `yaml:",inline"`
+
+		PollInterval       time.Duration       `yaml:"poll_interval,omitempty"`
+		Schedule           *ScheduleConfig     `yaml:"schedule,omitempty"`
+		TelegramRecipients []TelegramRecipient `yaml:"telegram_recipients,omitempty"`
 	}
 
 	TelegramConfig struct {
 		TelegramBotToken string `yaml:"telegram_bot_token,omitempty"`
 		TelegramChatID   int64  `yaml:"telegram_chat_id,omitempty"`
+
+		TelegramRecipients []TelegramRecipient    `yaml:"telegram_recipients,omitempty"`
+		Escalation         []EscalationStepConfig `yaml:"escalation,omitempty"`
+
+		TelegramAdminChatIDs []int64 `yaml:"telegram_admin_chat_ids,omitempty"`
+
+		TelegramStatusMessage bool   `yaml:"telegram_status_message,omitempty"`
+		TelegramWebhookURL    string `yaml:"telegram_webhook_url,omitempty"`
+		TelegramWebhookSecret string `yaml:"telegram_webhook_secret,omitempty"`
+
+		TelegramSubscriptions bool     `yaml:"telegram_subscriptions,omitempty"`
+		SubscribeCitizenships []string `yaml:"subscribe_citizenships,omitempty"`
+		MaxSubscribedProfiles int      `yaml:"max_subscribed_profiles,omitempty"`
+
+		TelegramParseMode string                             `yaml:"telegram_parse_mode,omitempty"`
+		MessageTemplates  map[prufen.NotificationKind]string `yaml:"message_templates,omitempty"`
+	}
+
+	TelegramRecipient struct {
+		ChatID   int64  `yaml:"chat_id"`
+		ThreadID int    `yaml:"thread_id,omitempty"`
+		Level    string `yaml:"level,omitempty"`
+	}
+
+	EscalationStepConfig struct {
+		After      time.Duration       `yaml:"after"`
+		Recipients []TelegramRecipient `yaml:"recipients,omitempty"`
+	}
+
+	ServiceConfig struct {
+		Name                string `yaml:"name"`
+		CategorySelector    string `yaml:"category_selector"`
+		ServiceSelector     string `yaml:"service_selector"`
+		ApplicationSelector string `yaml:"application_selector,omitempty"`
+		CategoriesSelector  string `yaml:"categories_selector,omitempty"`
+	}
+
+	ScheduleConfig struct {
+		Timezone string                 `yaml:"timezone,omitempty"`
+		Windows  []ScheduleWindowConfig `yaml:"windows"`
+	}
+
+	ScheduleWindowConfig struct {
+		Cron     string        `yaml:"cron,omitempty"`
+		Weekdays []string      `yaml:"weekdays,omitempty"`
+		From     string        `yaml:"from,omitempty"`
+		To       string        `yaml:"to,omitempty"`
+		Interval time.Duration `yaml:"interval,omitempty"`
+		Paused   bool          `yaml:"paused,omitempty"`
+		Holidays bool          `yaml:"holidays,omitempty"`
+		OffHours bool          `yaml:"off_hours,omitempty"`
+	}
+
+	OfficeHoursConfig struct {
+		Weekdays []string `yaml:"weekdays,omitempty"`
+		From     string   `yaml:"from,omitempty"`
+		To       string   `yaml:"to,omitempty"`
+	}
+
+	AdaptiveConfig struct {
+		MinInterval time.Duration `yaml:"min_interval"`
+		MaxInterval time.Duration `yaml:"max_interval"`
+		BoostPeriod time.Duration `yaml:"boost_period,omitempty"`
+		QuietPeriod time.Duration `yaml:"quiet_period,omitempty"`
+	}
+
+	ErrorBackoffConfig struct {
+		MaxInterval      time.Duration `yaml:"max_interval,omitempty"`
+		BreakerThreshold int           `yaml:"breaker_threshold,omitempty"`
+		ProbeInterval    time.Duration `yaml:"probe_interval,omitempty"`
+	}
+
+	StopConfig struct {
+		UntilFound bool      `yaml:"until_found,omitempty"`
+		MaxRuns    int       `yaml:"max_runs,omitempty"`
+		Deadline   time.Time `yaml:"deadline,omitempty"`
+	}
+
+	ExecHookConfig struct {
+		Name    string                    `yaml:"name"`
+		Command []string                  `yaml:"command"`
+		Timeout time.Duration             `yaml:"timeout,omitempty"`
+		Kinds   []prufen.NotificationKind `yaml:"kinds,omitempty"`
 	}
 
 	AppConfig struct {
 		ConfigFile              string
-		ScreenshotsDir          string        `yaml:"screenshots_dir,omitempty"`
-		Port                    int           `yaml:"port,omitempty"`
-		ScenarioTimeout         time.Duration `yaml:"scenario_timeout,omitempty"`
-		PollInterval            time.Duration `yaml:"poll_interval,omitempty"`
-		GracefulShutdownTimeout time.Duration `yaml:"graceful_shutdown_timeout,omitempty"`
+		ScreenshotsDir          string             `yaml:"screenshots_dir,omitempty"`
+		Port                    int                `yaml:"port,omitempty"`
+		APIToken                string             `yaml:"api_token,omitempty"`
+		ScenarioTimeout         time.Duration      `yaml:"scenario_timeout,omitempty"`
+		PollInterval            time.Duration      `yaml:"poll_interval,omitempty"`
+		Schedule                *ScheduleConfig    `yaml:"schedule,omitempty"`
+		OfficeHours             *OfficeHoursConfig `yaml:"office_hours,omitempty"`
+		PollJitter              float64            `yaml:"poll_jitter,omitempty"`
+		AdaptivePolling         *AdaptiveConfig    `yaml:"adaptive_polling,omitempty"`
+		ErrorBackoff            ErrorBackoffConfig `yaml:"error_backoff,omitempty"`
+		OverlapPolicy           string             `yaml:"overlap_policy,omitempty"`
+		Workers                 int                `yaml:"workers,omitempty"`
+		MaxRunsPerMinute        int                `yaml:"max_runs_per_minute,omitempty"`
+		Stop                    StopConfig         `yaml:"stop,omitempty"`
+		ReadinessRunWindow      time.Duration      `yaml:"readiness_run_window,omitempty"`
+		GracefulShutdownTimeout time.Duration      `yaml:"graceful_shutdown_timeout,omitempty"`
+		StateDir                string             `yaml:"state_dir,omitempty"`
+
+		NotifyCooldown        time.Duration `yaml:"notify_cooldown,omitempty"`
+		SlotsReminderInterval time.Duration `yaml:"slots_reminder_interval,omitempty"`
+
+		Profiles  []ProfileConfig          `yaml:"profiles,omitempty"`
+		ExecHooks []ExecHookConfig         `yaml:"exec_hooks,omitempty"`
+		Services  map[string]ServiceConfig `yaml:"services,omitempty"`
 
 		SingleRunMode bool `yaml:"single_run_mode,omitempty"`
 		Debug         bool `yaml:"debug,omitempty"`
 	}
 )
 
+func toRecipients(rcs []TelegramRecipient) []prufen.TelegramRecipient {
+	var res []prufen.TelegramRecipient
+	for _, rc := range rcs {
+		res = append(res, prufen.TelegramRecipient{
+			ChatID:   rc.ChatID,
+			ThreadID: rc.ThreadID,
+			Level:    prufen.NotifyLevel(rc.Level),
+		})
+	}
+
+	return res
+}
+
+func toSchedule(sc *ScheduleConfig) (*prufen.Schedule, error) {
+	if sc == nil {
+		return nil, nil
+	}
+
+	schedule := &prufen.Schedule{}
+	if sc.Timezone != "" {
+		loc, err := time.LoadLocation(sc.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q: %w", sc.Timezone, err)
+		}
+		schedule.Location = loc
+	}
+
+	for i, wc := range sc.Windows {
+		w := prufen.ScheduleWindow{
+			Cron:     wc.Cron,
+			Interval: wc.Interval,
+			Paused:   wc.Paused,
+			Holidays: wc.Holidays,
+			OffHours: wc.OffHours,
+		}
+
+		var err error
+		if w.Weekdays, err = toWeekdays(wc.Weekdays); err != nil {
+			return nil, fmt.Errorf("window #%d: %w", i, err)
+		}
+		if w.From, err = toTimeOfDay(wc.From); err != nil {
+			return nil, fmt.Errorf("window #%d: %w", i, err)
+		}
+		if w.To, err = toTimeOfDay(wc.To); err != nil {
+			return nil, fmt.Errorf("window #%d: %w", i, err)
+		}
+
+		schedule.Windows = append(schedule.Windows, w)
+	}
+
+	return schedule, nil
+}
+
+func toOfficeHours(oc *OfficeHoursConfig) (prufen.OfficeHours, error) {
+	var hours prufen.OfficeHours
+	if oc == nil {
+		return hours, nil
+	}
+
+	var err error
+	if hours.Weekdays, err = toWeekdays(oc.Weekdays); err != nil {
+		return hours, err
+	}
+	if hours.From, err = toTimeOfDay(oc.From); err != nil {
+		return hours, err
+	}
+	if hours.To, err = toTimeOfDay(oc.To); err != nil {
+		return hours, err
+	}
+
+	return hours, nil
+}
+
+// toWeekdays parses short weekday names, e.g. mon, tue.
+func toWeekdays(names []string) ([]time.Weekday, error) {
+	weekdays := map[string]time.Weekday{}
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		weekdays[strings.ToLower(wd.String()[:3])] = wd
+	}
+
+	var res []time.Weekday
+	for _, name := range names {
+		wd, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q, should be one of mon, tue, ...", name)
+		}
+		res = append(res, wd)
+	}
+
+	return res, nil
+}
+
+// toTimeOfDay parses a time of day like 07:30 into the duration since midnight.
+func toTimeOfDay(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if v == "24:00" {
+		return time.Hour * 24, nil
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, should be like 07:30", v)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
 func getConfig() (*Config, error) {
 	debug := flag.Bool("debug", false, "Print debug logs from Chrome to the stdout stream")
 	singleMode := flag.Bool("single-run-mode", false, "Run the application only once. Could be useful for test purposes or to develop more automations")
@@ -160,8 +515,18 @@ func getConfig() (*Config, error) {
 	if reflect.ValueOf(cfg.TelegramConfig).IsZero() {
 		return nil, fmt.Errorf("no telegram API credentials were given")
 	}
-	if cfg.TelegramChatID < 1 {
-		return nil, fmt.Errorf("wrong value in param \"telegram_chat_id\" %d, should be more than 1", cfg.TelegramChatID)
+	// profiles could have their own recipients
+	ownRecipients := len(cfg.Profiles) > 0 && reflect.ValueOf(cfg.AbhConfig).IsZero()
+	for _, pc := range cfg.Profiles {
+		ownRecipients = ownRecipients && len(pc.TelegramRecipients) > 0
+	}
+	if cfg.TelegramChatID == 0 && len(cfg.TelegramRecipients) == 0 && !cfg.TelegramSubscriptions && !ownRecipients {
+		return nil, fmt.Errorf("neither param \"telegram_chat_id\" nor \"telegram_recipients\" were given")
+	}
+	for i, rc := range cfg.TelegramRecipients {
+		if rc.ChatID == 0 {
+			return nil, fmt.Errorf("no \"chat_id\" in the \"telegram_recipients\" item #%d", i)
+		}
 	}
 
 	screenshotDirAbs, err := filepath.Abs(cfg.ScreenshotsDir)
@@ -170,22 +535,54 @@ func getConfig() (*Config, error) {
 	}
 	cfg.ScreenshotsDir = screenshotDirAbs
 
+	if cfg.StateDir != "" {
+		stateDirAbs, err := filepath.Abs(cfg.StateDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get abs path for %q: %v", cfg.StateDir, err)
+		}
+		cfg.StateDir = stateDirAbs
+	}
+
+	for i, pc := range cfg.Profiles {
+		if pc.Name == "" {
+			return nil, fmt.Errorf("no \"name\" in the \"profiles\" item #%d", i)
+		}
+		if err := validateAbhConfig(&pc.AbhConfig); err != nil {
+			return nil, fmt.Errorf("profile %q: %v", pc.Name, err)
+		}
+	}
+
 	// validate a little abh config
 	if reflect.ValueOf(cfg.AbhConfig).IsZero() {
+		if cfg.TelegramSubscriptions || len(cfg.Profiles) > 0 {
+			// users subscribe to their own profiles, or profiles are listed
+			return &cfg, nil
+		}
 		return nil, fmt.Errorf("no ABH config were given")
 	}
+	if err := validateAbhConfig(cfg.AbhConfig); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func validateAbhConfig(cfg *AbhConfig) error {
+	if cfg.Citizenship == "" {
+		return fmt.Errorf("no param \"citizenship\" was given")
+	}
 	if cfg.LiveInBerlin != "yes" &&
 		cfg.LiveInBerlin != "no" {
-		return nil, fmt.Errorf("param \"live_in_berlin\" can only be \"yes\" or \"no\", got %q", cfg.LiveInBerlin)
+		return fmt.Errorf("param \"live_in_berlin\" can only be \"yes\" or \"no\", got %q", cfg.LiveInBerlin)
 	}
 	numApp, err := strconv.ParseInt(cfg.PeopleNumber, 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse param \"people_number\" %q: %v", cfg.PeopleNumber, err)
+		return fmt.Errorf("failed to parse param \"people_number\" %q: %v", cfg.PeopleNumber, err)
 	}
 	if numApp < 1 || numApp > 8 {
-		return nil, fmt.Errorf("wrong number in param \"people_number\" given %d, valid [1-8]", numApp)
+		return fmt.Errorf("wrong number in param \"people_number\" given %d, valid [1-8]", numApp)
 	}
 	// TODO: validate reason?
 
-	return &cfg, nil
+	return nil
 }
@@ -0,0 +1,83 @@
+package prufen
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// AdaptivePolling speeds polling up after slots were seen or the outcome has
+// changed, and slows it down during quiet periods. It applies to the interval
+// of the active schedule window, or to the PollInterval.
+type AdaptivePolling struct {
+	// MinInterval is the interval during the BoostPeriod, and the lowest
+	// interval overall.
+	MinInterval time.Duration
+	// MaxInterval is the highest interval the polling slows down to.
+	MaxInterval time.Duration
+	// BoostPeriod is the duration to poll with the MinInterval for
+	// after slots were seen or the outcome has changed.
+	BoostPeriod time.Duration
+	// QuietPeriod is the duration without outcome changes after which
+	// the interval is doubled, and doubled again after each next one.
+	// The interval is not slowed down if it's zero.
+	QuietPeriod time.Duration
+}
+
+func (a AdaptivePolling) validate() error {
+	if a.MinInterval <= 0 || a.MaxInterval <= 0 {
+		return fmt.Errorf("min and max intervals should be positive")
+	}
+	if a.MinInterval > a.MaxInterval {
+		return fmt.Errorf("min interval %s is greater than max interval %s", a.MinInterval, a.MaxInterval)
+	}
+	if a.BoostPeriod < 0 || a.QuietPeriod < 0 {
+		return fmt.Errorf("negative boost or quiet period")
+	}
+
+	return nil
+}
+
+// interval adapts the base interval, changedAt is the time of the last
+// outcome change or slots seen, quietSince is the time of the first outcome,
+// polling is quiet since then until anything changes.
+func (a *AdaptivePolling) interval(base time.Duration, now, changedAt, quietSince time.Time) time.Duration {
+	if a == nil {
+		return base
+	}
+
+	var quiet time.Duration
+	switch {
+	case !changedAt.IsZero():
+		since := now.Sub(changedAt)
+		if since < a.BoostPeriod {
+			return a.MinInterval
+		}
+		quiet = since - a.BoostPeriod
+	case !quietSince.IsZero():
+		quiet = now.Sub(quietSince)
+	}
+	if a.QuietPeriod > 0 {
+		for ; quiet >= a.QuietPeriod && base < a.MaxInterval; quiet -= a.QuietPeriod {
+			base *= 2
+		}
+	}
+
+	if base < a.MinInterval {
+		return a.MinInterval
+	}
+	if base > a.MaxInterval {
+		return a.MaxInterval
+	}
+
+	return base
+}
+
+// jitterFactor returns a random factor within [1-jitter, 1+jitter].
+func jitterFactor(jitter float64) float64 {
+	if jitter <= 0 {
+		return 1
+	}
+
+	return 1 + jitter*(rand.Float64()*2-1)
+}
@@ -0,0 +1,133 @@
+package prufen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptivePollingInterval(t *testing.T) {
+	a := &AdaptivePolling{
+		MinInterval: time.Minute,
+		MaxInterval: time.Minute * 15,
+		BoostPeriod: time.Minute * 30,
+		QuietPeriod: time.Hour * 2,
+	}
+	now := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	base := time.Minute * 3
+
+	tests := []struct {
+		name       string
+		adaptive   *AdaptivePolling
+		changedAt  time.Time
+		quietSince time.Time
+		want       time.Duration
+	}{
+		{
+			name: "disabled",
+			want: base,
+		},
+		{
+			name:     "no outcome yet",
+			adaptive: a,
+			want:     base,
+		},
+		{
+			name:       "quiet since start within the quiet period",
+			adaptive:   a,
+			quietSince: now.Add(-time.Hour),
+			want:       base,
+		},
+		{
+			name:       "quiet since start for a quiet period",
+			adaptive:   a,
+			quietSince: now.Add(-time.Hour * 2),
+			want:       base * 2,
+		},
+		{
+			name:       "quiet since start for two quiet periods",
+			adaptive:   a,
+			quietSince: now.Add(-time.Hour * 5),
+			want:       base * 4,
+		},
+		{
+			name:       "quiet since start up to the max interval",
+			adaptive:   a,
+			quietSince: now.Add(-time.Hour * 24),
+			want:       a.MaxInterval,
+		},
+		{
+			name:       "boost after a change",
+			adaptive:   a,
+			changedAt:  now.Add(-time.Minute * 10),
+			quietSince: now.Add(-time.Hour * 24),
+			want:       a.MinInterval,
+		},
+		{
+			name:       "after the boost",
+			adaptive:   a,
+			changedAt:  now.Add(-time.Minute * 40),
+			quietSince: now.Add(-time.Hour * 24),
+			want:       base,
+		},
+		{
+			name:       "quiet after the boost",
+			adaptive:   a,
+			changedAt:  now.Add(-time.Minute*30 - time.Hour*2),
+			quietSince: now.Add(-time.Hour * 24),
+			want:       base * 2,
+		},
+		{
+			name:       "no slowdown without the quiet period",
+			adaptive:   &AdaptivePolling{MinInterval: time.Minute, MaxInterval: time.Hour},
+			quietSince: now.Add(-time.Hour * 24),
+			want:       base,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.adaptive.interval(base, now, tt.changedAt, tt.quietSince); got != tt.want {
+				t.Errorf("interval() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerQuietSlowdown(t *testing.T) {
+	a := &AdaptivePolling{
+		MinInterval: time.Minute,
+		MaxInterval: time.Minute * 15,
+		BoostPeriod: time.Minute * 30,
+		QuietPeriod: time.Hour * 2,
+	}
+	s := newScheduler("test", time.Minute*3, nil, a, 0, ErrorBackoff{})
+
+	p := Profile{Citizenship: "Ukraine", PeopleNumber: "1"}
+	s.finished([]Result{{Profile: p}})
+	if s.quietSince.IsZero() {
+		t.Fatal("the first outcome does not start the quiet period")
+	}
+	if !s.changedAt.IsZero() {
+		t.Fatal("the first outcome without slots is taken as a change")
+	}
+
+	// no slots since the start for a quiet period
+	s.quietSince = s.quietSince.Add(-time.Hour * 2)
+	s.lastStart = time.Now()
+	if got, want := s.nextRun().Sub(s.lastStart), time.Minute*6; got < want-time.Second || got > want {
+		t.Errorf("next run in %s, want %s", got, want)
+	}
+
+	s.finished([]Result{{Profile: p}})
+	if !s.changedAt.IsZero() {
+		t.Error("the same outcome is taken as a change")
+	}
+
+	s.finished([]Result{{Profile: p, SlotsAvailable: true}})
+	if s.changedAt.IsZero() {
+		t.Error("slots are not taken as a change")
+	}
+	if got, want := s.nextRun().Sub(s.lastStart), a.MinInterval; got < want-time.Second || got > want {
+		t.Errorf("next run in %s after slots, want %s", got, want)
+	}
+}
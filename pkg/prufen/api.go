@@ -0,0 +1,247 @@
+package prufen
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRunsLimit is the number of runs returned by GET /api/v1/runs by default.
+const defaultRunsLimit = 10
+
+type (
+	// watchStatus is the state of a watch returned by GET /api/v1/status.
+	watchStatus struct {
+		Name string `json:"name"`
+		// Profile is nil for the subscriptions watch.
+		Profile *Profile `json:"profile,omitempty"`
+		schedulerStatus
+	}
+
+	// apiStatus is returned by GET /api/v1/status.
+	apiStatus struct {
+		Watches         []watchStatus `json:"watches"`
+		OfficeOpen      bool          `json:"office_open"`
+		Holiday         string        `json:"holiday,omitempty"`
+		NextBusinessDay time.Time     `json:"next_business_day,omitempty"`
+	}
+)
+
+// handleRuns triggers runs of all of the watches, or of a single one by
+// the "watch" query param, with POST /api/v1/runs, the runs are queued
+// and could be read later. GET /api/v1/runs returns up to the "limit"
+// last runs, the newest first.
+func (r *Runner) handleRuns(w http.ResponseWriter, req *http.Request) {
+	watches, err := r.selectWatches(req.URL.Query().Get("watch"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	switch req.Method {
+	case http.MethodPost:
+		queued := []string{}
+		for _, wt := range watches {
+			if wt.sched.requestCheck(nil) {
+				queued = append(queued, wt.name)
+			}
+		}
+		if len(queued) == 0 {
+			writeJSONError(w, http.StatusConflict, "a run has already been requested")
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]any{"queued": queued})
+
+	case http.MethodGet:
+		limit := defaultRunsLimit
+		if v := req.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > historySize {
+				writeJSONError(w, http.StatusBadRequest, "limit should be a number from 1 to "+strconv.Itoa(historySize))
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"runs": r.history(watches, limit)})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleLatestRun returns the last run with GET /api/v1/runs/latest,
+// optionally of a single watch by the "watch" query param.
+func (r *Runner) handleLatestRun(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	watches, err := r.selectWatches(req.URL.Query().Get("watch"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	runs := r.history(watches, 1)
+	if len(runs) == 0 {
+		writeJSONError(w, http.StatusNotFound, "no runs yet")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, runs[0])
+}
+
+// handleStatus returns the state of the watches with GET /api/v1/status.
+func (r *Runner) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	now := time.Now()
+	st := apiStatus{
+		Watches:    make([]watchStatus, 0, len(r.watches)),
+		OfficeOpen: r.officeHours.open(now),
+	}
+	st.Holiday, _ = berlinHoliday(now)
+	if !st.OfficeOpen {
+		st.NextBusinessDay = r.officeHours.nextOpening(now)
+	}
+	for _, wt := range r.watches {
+		st.Watches = append(st.Watches, watchStatus{
+			Name:            wt.name,
+			Profile:         wt.profile,
+			schedulerStatus: wt.sched.status(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, st)
+}
+
+// handleAlertAck acknowledges an alert with POST /api/v1/alerts/{id}/ack,
+// the optional "by" query param names who has acknowledged it.
+func (r *Runner) handleAlertAck(w http.ResponseWriter, req *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(req.URL.Path, "/api/v1/alerts/"), "/ack")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if req.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	by := req.URL.Query().Get("by")
+	if by == "" {
+		by = "HTTP API"
+	}
+
+	if !r.ackAlert(id, by) {
+		writeJSONError(w, http.StatusNotFound, "no such an open alert")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "acknowledged": true})
+}
+
+// requireToken requires the API token from the POST requests and rejects
+// cross-origin ones, other requests only read the state and pass as is.
+func (r *Runner) requireToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			h(w, req)
+			return
+		}
+
+		// browsers send the Origin with cross-origin requests, these are
+		// forged by other pages the dashboard user visits, proxies may
+		// replace the Host keeping the original one in the X-Forwarded-Host
+		if origin := req.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || (u.Host != req.Host && u.Host != req.Header.Get("X-Forwarded-Host")) {
+				writeJSONError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+				return
+			}
+		}
+
+		if r.apiToken == "" {
+			writeJSONError(w, http.StatusForbidden, "the API token is not configured")
+			return
+		}
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(r.apiToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "invalid API token")
+			return
+		}
+
+		h(w, req)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// handlePause pauses polling with POST /api/v1/pause and resumes it with
+// POST /api/v1/resume, of all of the watches or of a single one by the "watch"
+// query param.
+func (r *Runner) handlePause(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	watches, err := r.selectWatches(req.URL.Query().Get("watch"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	paused := req.URL.Path == "/api/v1/pause"
+	changed := r.setPaused(watches, paused)
+	writeJSON(w, http.StatusOK, map[string]any{"paused": paused, "changed": changed})
+}
+
+// handleArtifacts lists the last screenshots with GET /api/v1/artifacts.
+func (r *Runner) handleArtifacts(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"artifacts": r.artifacts.list()})
+}
+
+// handleArtifact returns the screenshot with GET /api/v1/artifacts/{id}.
+func (r *Runner) handleArtifact(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(req.URL.Path, "/api/v1/artifacts/"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	image, ok := r.artifacts.image(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "no such an artifact")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=86400, immutable")
+	_, _ = w.Write(image)
+}
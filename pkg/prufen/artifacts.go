@@ -0,0 +1,84 @@
+package prufen
+
+import (
+	"sync"
+	"time"
+)
+
+// artifactsSize is the number of the last screenshots kept in memory.
+const artifactsSize = 20
+
+type (
+	// artifact is the screenshot of the final page of a run, or of the page
+	// a run has failed on.
+	artifact struct {
+		ID             int64         `json:"id"`
+		Profile        Profile       `json:"profile"`
+		StartedAt      time.Time     `json:"started_at"`
+		Duration       time.Duration `json:"duration"`
+		SlotsAvailable bool          `json:"slots_available"`
+		Error          string        `json:"error,omitempty"`
+
+		image []byte
+	}
+
+	// artifacts is a ring of the last screenshots for the dashboard gallery.
+	artifacts struct {
+		mu    sync.Mutex
+		seq   int64
+		items []*artifact
+	}
+)
+
+// add keeps the screenshot of the result, if any.
+func (a *artifacts) add(res Result) {
+	if len(res.Screenshot) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.seq++
+	a.items = append(a.items, &artifact{
+		ID:             a.seq,
+		Profile:        res.Profile,
+		StartedAt:      res.StartedAt,
+		Duration:       res.Duration,
+		SlotsAvailable: res.SlotsAvailable,
+		Error:          res.Error,
+		image:          res.Screenshot,
+	})
+	if len(a.items) > artifactsSize {
+		a.items = append([]*artifact(nil), a.items[len(a.items)-artifactsSize:]...)
+	}
+}
+
+// list returns the artifacts without images, the newest first.
+func (a *artifacts) list() []artifact {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	res := make([]artifact, 0, len(a.items))
+	for i := len(a.items) - 1; i >= 0; i-- {
+		item := *a.items[i]
+		item.image = nil
+		res = append(res, item)
+	}
+
+	return res
+}
+
+// image returns the screenshot of the artifact with the given ID.
+func (a *artifacts) image(id int64) ([]byte, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, item := range a.items {
+		if item.ID == id {
+			return item.image, true
+		}
+	}
+
+	return nil, false
+}
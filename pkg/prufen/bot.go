@@ -0,0 +1,229 @@
+package prufen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// callbackAck is the callback data prefix of the acknowledge button.
+	callbackAck = "ack"
+	// callbackNoop is the callback data of buttons without any action.
+	callbackNoop = "noop"
+
+	// updatesPollTimeout is the long polling timeout of the updates,
+	// it's within the timeout of the telegram requests.
+	updatesPollTimeout = telegramRequestTimeout - time.Second*5
+	// updatesRetryInterval is the pause after a failed poll of the updates.
+	updatesRetryInterval = time.Second * 3
+)
+
+// botUpdate is the bot update along with the forum topic of its message,
+// or of the message the callback came from, which tgbotapi lacks.
+type botUpdate struct {
+	tgbotapi.Update
+	ThreadID int
+}
+
+func (u *botUpdate) UnmarshalJSON(bb []byte) error {
+	if err := json.Unmarshal(bb, &u.Update); err != nil {
+		return err
+	}
+
+	type topic struct {
+		ThreadID int `json:"message_thread_id"`
+	}
+	var raw struct {
+		Message       *topic `json:"message"`
+		CallbackQuery *struct {
+			Message *topic `json:"message"`
+		} `json:"callback_query"`
+	}
+	if err := json.Unmarshal(bb, &raw); err != nil {
+		return err
+	}
+
+	switch {
+	case raw.Message != nil:
+		u.ThreadID = raw.Message.ThreadID
+	case raw.CallbackQuery != nil && raw.CallbackQuery.Message != nil:
+		u.ThreadID = raw.CallbackQuery.Message.ThreadID
+	}
+
+	return nil
+}
+
+// receiveUpdates registers the webhook if it's configured,
+// otherwise or if it fails, the updates are long polled.
+func (r *Runner) receiveUpdates(ctx context.Context) {
+	if r.webhookURL != nil {
+		err := r.setWebhook()
+		if err == nil {
+			r.logger.Info("receiving bot updates with webhook", "url", r.webhookURL.Redacted())
+			return
+		}
+		r.logger.Error("falling back to long polling of bot updates", "error", err)
+	}
+
+	// updates could not be polled while a webhook is set
+	if err := r.deleteWebhook(); err != nil {
+		r.logger.Warn("failed to delete webhook", "error", err)
+	}
+
+	go r.listenUpdates(ctx)
+}
+
+// listenUpdates handles the bot updates until the context is done.
+// The tgbotapi updates channel lacks forum topics, hence the raw requests.
+func (r *Runner) listenUpdates(ctx context.Context) {
+	offset := 0
+	for ctx.Err() == nil {
+		updates, err := r.getUpdates(offset)
+		if err != nil {
+			r.logger.Error("failed to get bot updates", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(updatesRetryInterval):
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			if u.UpdateID >= offset {
+				offset = u.UpdateID + 1
+				r.handleUpdate(u)
+			}
+		}
+	}
+}
+
+func (r *Runner) getUpdates(offset int) ([]botUpdate, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero("offset", offset)
+	params.AddNonZero("timeout", int(updatesPollTimeout.Seconds()))
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.botClient.MakeRequest("getUpdates", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []botUpdate
+	if err := json.Unmarshal(resp.Result, &updates); err != nil {
+		return nil, fmt.Errorf("failed to decode updates: %w", err)
+	}
+
+	return updates, nil
+}
+
+func (r *Runner) handleUpdate(u botUpdate) {
+	switch {
+	case u.CallbackQuery != nil:
+		r.handleCallback(u.CallbackQuery, u.ThreadID)
+	case u.Message != nil && u.Message.IsCommand():
+		r.handleCommand(u.Message)
+	case u.Message != nil && u.Message.Text != "":
+		r.handleSubscriptionText(u.Message)
+	}
+}
+
+// handleCallback handles the buttons, the thread is the forum topic
+// of the message the callback came from.
+func (r *Runner) handleCallback(cq *tgbotapi.CallbackQuery, threadID int) {
+	action, arg, _ := strings.Cut(cq.Data, ":")
+
+	switch action {
+	case callbackAck:
+		by := cq.From.String()
+		if !r.ackAllowed(cq, threadID, arg) {
+			r.logger.Warn("unauthorized alert acknowledgement", "alert", arg, "by", by)
+			r.answerCallback(cq, "You are not allowed to acknowledge this alert")
+			return
+		}
+		if !r.ackAlert(arg, by) {
+			r.answerCallback(cq, "Already acknowledged")
+			return
+		}
+
+		r.answerCallback(cq, "Acknowledged")
+		r.replaceKeyboard(cq, tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Acknowledged by "+by, callbackNoop),
+		)))
+
+	case callbackBooked, callbackSnooze, callbackUseless:
+		r.handleSlotsAction(cq, threadID, action, arg)
+
+	case callbackSubscribe:
+		r.handleSubscriptionCallback(cq, arg)
+
+	case callbackNoop:
+		r.answerCallback(cq, "")
+
+	default:
+		r.answerCallback(cq, "Unknown action")
+	}
+}
+
+// ackAllowed reports whether the alert could be acknowledged from the chat
+// topic the callback came from: by admins and configured recipients, and by
+// subscribers of the alert profile.
+func (r *Runner) ackAllowed(cq *tgbotapi.CallbackQuery, threadID int, alertID string) bool {
+	var chatID int64
+	if cq.Message != nil {
+		chatID = cq.Message.Chat.ID
+	}
+	if r.recipientAllowed(chatID, threadID, cq.From) {
+		return true
+	}
+
+	sub, ok := r.subs.get(chatID)
+	if !ok {
+		return false
+	}
+
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	for _, a := range r.state.Alerts {
+		if a.ID == alertID {
+			return a.Data.Profile.key() == sub.key()
+		}
+	}
+
+	// the alert is acknowledged already
+	return true
+}
+
+func (r *Runner) answerCallback(cq *tgbotapi.CallbackQuery, text string) {
+	if _, err := r.botClient.Request(tgbotapi.NewCallback(cq.ID, text)); err != nil {
+		r.logger.Error("failed to answer callback query", "error", err)
+	}
+}
+
+// replaceKeyboard replaces the keyboard of the message the callback came from.
+func (r *Runner) replaceKeyboard(cq *tgbotapi.CallbackQuery, markup tgbotapi.InlineKeyboardMarkup) {
+	if cq.Message == nil {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageReplyMarkup(cq.Message.Chat.ID, cq.Message.MessageID, markup)
+	if _, err := r.botClient.Request(edit); err != nil {
+		r.logger.Error("failed to edit message keyboard", "error", err)
+	}
+}
+
+// ackKeyboard is attached to alerts which could be acknowledged.
+func ackKeyboard(alertID string) *tgbotapi.InlineKeyboardMarkup {
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Acknowledge", callbackAck+":"+alertID),
+	))
+
+	return &markup
+}
@@ -0,0 +1,164 @@
+package prufen
+
+import (
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// snoozeDuration is the time notifications are not sent to a snoozed chat.
+const snoozeDuration = time.Hour
+
+const (
+	// callbackBooked, callbackSnooze and callbackUseless are the callback
+	// data prefixes of the slots actions buttons, followed by the profile ref.
+	callbackBooked  = "booked"
+	callbackSnooze  = "snooze"
+	callbackUseless = "useless"
+)
+
+// slotsKeyboard is attached to notifications about available slots.
+func slotsKeyboard(data messageData) *tgbotapi.InlineKeyboardMarkup {
+	ref := data.Profile.ref()
+
+	rows := [][]tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Booked – stop", callbackBooked+":"+ref),
+		tgbotapi.NewInlineKeyboardButtonData("💤 Snooze 1h", callbackSnooze+":"+ref),
+		tgbotapi.NewInlineKeyboardButtonData("👎 Not useful", callbackUseless+":"+ref),
+	)}
+	if data.AlertID != "" {
+		rows = append(rows, ackKeyboard(data.AlertID).InlineKeyboard...)
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// handleSlotsAction handles the slots actions buttons. The action applies
+// to the subscription if the chat is subscribed to the profile, otherwise
+// to the configured profile, which only admins and its recipients are
+// allowed to act on.
+func (r *Runner) handleSlotsAction(cq *tgbotapi.CallbackQuery, threadID int, action, ref string) {
+	if cq.Message == nil {
+		r.answerCallback(cq, "")
+		return
+	}
+
+	chatID, by := cq.Message.Chat.ID, cq.From.String()
+
+	var w *watch
+	p, subscribed := r.subs.get(chatID)
+	subscription := subscribed && p.ref() == ref
+	if !subscription {
+		if !r.recipientAllowed(chatID, threadID, cq.From) {
+			if subscribed {
+				// subscribers act on their own profile only
+				r.answerCallback(cq, "The profile is not checked anymore")
+				return
+			}
+			r.logger.Warn("unauthorized slots action", "action", action, "chat", chatID, "by", by)
+			r.answerCallback(cq, "You are not allowed to control this bot")
+			return
+		}
+
+		var ok bool
+		if w, ok = r.watchByRef(ref); !ok {
+			r.answerCallback(cq, "The profile is not checked anymore")
+			return
+		}
+		p = *w.profile
+	}
+
+	l := r.logger.With("chat", chatID, "by", by, "profile", p.key())
+
+	var label string
+	switch action {
+	case callbackBooked:
+		if subscription {
+			if _, err := r.subs.remove(chatID); err != nil {
+				l.Error("failed to save subscriptions", "error", err)
+				r.answerCallback(cq, "Failed to unsubscribe, please try again later")
+				return
+			}
+			l.Info("slots booked, chat unsubscribed")
+			label = "✅ Booked by " + by + ", unsubscribed"
+			break
+		}
+
+		r.stateMu.Lock()
+		r.notifyState(p).Done = true
+		r.closeAlerts(p)
+		r.saveState()
+		r.stateMu.Unlock()
+
+		label = "✅ Booked by " + by
+		if len(r.profiles(w)) == 0 {
+			w.sched.setPaused(true)
+			r.saveSchedulers()
+			r.stateChanged(w, "booked")
+			label += ", polling is paused"
+		}
+		l.Info("slots booked, profile is done")
+
+	case callbackSnooze:
+		// only the chat topic is snoozed, the alerts keep
+		// escalating to the other recipients
+		until := time.Now().Add(snoozeDuration)
+		id := (&telegramNotifier{to: TelegramRecipient{ChatID: chatID, ThreadID: threadID}}).id()
+
+		r.stateMu.Lock()
+		if r.state.Snoozed == nil {
+			r.state.Snoozed = map[string]time.Time{}
+		}
+		r.state.Snoozed[id] = until
+		r.saveState()
+		r.stateMu.Unlock()
+
+		l.Info("notifications snoozed", "until", until)
+		label = fmt.Sprintf("💤 Snoozed by %s until %s", by, until.Format(time.TimeOnly))
+
+	case callbackUseless:
+		r.stateMu.Lock()
+		r.notifyState(p).Dismissed = true
+		r.closeAlerts(p)
+		r.saveState()
+		r.stateMu.Unlock()
+
+		l.Info("slots marked as not useful")
+		label = "👎 Not useful, marked by " + by
+	}
+
+	r.answerCallback(cq, "")
+	r.replaceKeyboard(cq, tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(label, callbackNoop),
+	)))
+}
+
+// recipientAllowed reports whether the chat topic is a configured
+// recipient, escalation ones included, or the chat or the user is an admin one.
+func (r *Runner) recipientAllowed(chatID int64, threadID int, from *tgbotapi.User) bool {
+	if r.authorizedChat(chatID, from) {
+		return true
+	}
+
+	for _, n := range r.notifiers {
+		if tn, ok := n.(*telegramNotifier); ok && tn.to.ChatID == chatID && tn.to.ThreadID == threadID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// snoozed reports whether notifications to the notifier are snoozed.
+// Must be called with the stateMu held.
+func (r *Runner) snoozed(id string, now time.Time) bool {
+	until, ok := r.state.Snoozed[id]
+	if ok && !now.Before(until) {
+		delete(r.state.Snoozed, id)
+		return false
+	}
+
+	return ok
+}
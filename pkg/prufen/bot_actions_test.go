@@ -0,0 +1,300 @@
+package prufen
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/exp/slog"
+)
+
+// testBot is a fake Telegram Bot API recording the requests.
+type testBot struct {
+	mu       sync.Mutex
+	requests []testBotRequest
+}
+
+type testBotRequest struct {
+	method string
+	params map[string]string
+}
+
+func newTestBot(t *testing.T) (*tgbotapi.BotAPI, *testBot) {
+	t.Helper()
+
+	tb := &testBot{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		params := map[string]string{}
+		for k := range req.PostForm {
+			params[k] = req.PostForm.Get(k)
+		}
+
+		method := path.Base(req.URL.Path)
+		tb.mu.Lock()
+		tb.requests = append(tb.requests, testBotRequest{method: method, params: params})
+		tb.mu.Unlock()
+
+		if method == "getMe" {
+			_, _ = io.WriteString(w, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"ok":true,"result":true}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("token", srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api, tb
+}
+
+// answers returns the texts of the answered callbacks and forgets them.
+func (tb *testBot) answers() []string {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	var res []string
+	for _, req := range tb.requests {
+		if req.method == "answerCallbackQuery" {
+			res = append(res, req.params["text"])
+		}
+	}
+	tb.requests = nil
+
+	return res
+}
+
+func newTestCallback(chatID, fromID int64, data string) *tgbotapi.CallbackQuery {
+	return &tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &tgbotapi.User{ID: fromID, UserName: "user"},
+		Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: chatID}},
+		Data:    data,
+	}
+}
+
+func TestHandleSlotsAction(t *testing.T) {
+	configured := Profile{Citizenship: "Ukraine", PeopleNumber: "1", Service: "blue-card"}
+	subscribed := Profile{Citizenship: "India", PeopleNumber: "2", Service: "blue-card"}
+
+	const (
+		admin      = 1 // subscribed to its own profile as well
+		subscriber = 2
+		stranger   = 3
+		family     = 4 // the recipient of the configured profile in a forum topic
+		topic      = 7
+	)
+
+	tests := []struct {
+		name     string
+		chatID   int64
+		threadID int
+		profile  Profile
+		answer   string
+		// dismissed is the profile marked as not useful, if any.
+		dismissed *Profile
+	}{
+		{
+			name:      "admin on the configured profile",
+			chatID:    admin,
+			profile:   configured,
+			dismissed: &configured,
+		},
+		{
+			name:      "admin on the subscription",
+			chatID:    admin,
+			profile:   subscribed,
+			dismissed: &subscribed,
+		},
+		{
+			name:      "subscriber on the subscription",
+			chatID:    subscriber,
+			profile:   subscribed,
+			dismissed: &subscribed,
+		},
+		{
+			name:    "subscriber on the configured profile",
+			chatID:  subscriber,
+			profile: configured,
+			answer:  "The profile is not checked anymore",
+		},
+		{
+			name:    "stranger",
+			chatID:  stranger,
+			profile: configured,
+			answer:  "You are not allowed to control this bot",
+		},
+		{
+			name:      "recipient in its topic",
+			chatID:    family,
+			threadID:  topic,
+			profile:   configured,
+			dismissed: &configured,
+		},
+		{
+			name:    "recipient out of its topic",
+			chatID:  family,
+			profile: configured,
+			answer:  "You are not allowed to control this bot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, tb := newTestBot(t)
+			r := &Runner{
+				botClient:    bot,
+				logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				adminChatIDs: []int64{admin},
+				subs: &subscriptions{byChat: map[int64]Profile{
+					admin:      subscribed,
+					subscriber: subscribed,
+				}},
+			}
+			recipient := r.register(&telegramNotifier{r: r, to: TelegramRecipient{ChatID: family, ThreadID: topic}})
+			r.watches = []*watch{{name: "family", profile: &configured, targets: []notifier{recipient}}}
+
+			r.handleSlotsAction(newTestCallback(tt.chatID, tt.chatID, callbackUseless+":"+tt.profile.ref()), tt.threadID, callbackUseless, tt.profile.ref())
+
+			if got := tb.answers(); len(got) != 1 || got[0] != tt.answer {
+				t.Errorf("answers = %q, want %q", got, tt.answer)
+			}
+			for _, p := range []Profile{configured, subscribed} {
+				want := tt.dismissed != nil && tt.dismissed.key() == p.key()
+				if got := r.notifyState(p).Dismissed; got != want {
+					t.Errorf("%s is dismissed: %v, want %v", p.Citizenship, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSlotsActionSnooze(t *testing.T) {
+	bot, tb := newTestBot(t)
+	r := &Runner{
+		botClient: bot,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		subs:      &subscriptions{byChat: map[int64]Profile{}},
+	}
+	p := Profile{Citizenship: "Ukraine", PeopleNumber: "1", Service: "blue-card"}
+	group := r.register(&telegramNotifier{r: r, to: TelegramRecipient{ChatID: -100}})
+	topic := r.register(&telegramNotifier{r: r, to: TelegramRecipient{ChatID: -100, ThreadID: 7}})
+	r.watches = []*watch{{name: "default", profile: &p, targets: []notifier{group, topic}}}
+	r.state.Alerts = []*alert{{ID: "a1", Data: messageData{Result: Result{Profile: p}}}}
+
+	r.handleSlotsAction(newTestCallback(-100, 5, callbackSnooze+":"+p.ref()), 7, callbackSnooze, p.ref())
+
+	if got := tb.answers(); len(got) != 1 || got[0] != "" {
+		t.Fatalf("answers = %q, want the snooze to succeed", got)
+	}
+	if _, ok := r.state.Snoozed[topic.id()]; !ok {
+		t.Error("the topic is not snoozed")
+	}
+	if _, ok := r.state.Snoozed[group.id()]; ok {
+		t.Error("the whole group is snoozed")
+	}
+	if len(r.state.Alerts) != 1 {
+		t.Error("the alert is closed for the other recipients")
+	}
+}
+
+func TestBotUpdateThreadID(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want int
+	}{
+		{
+			name: "message in a topic",
+			raw:  `{"update_id":1,"message":{"message_id":1,"message_thread_id":7,"chat":{"id":-100},"text":"/status"}}`,
+			want: 7,
+		},
+		{
+			name: "callback in a topic",
+			raw:  `{"update_id":1,"callback_query":{"id":"1","from":{"id":5},"message":{"message_id":1,"message_thread_id":7,"chat":{"id":-100}},"data":"noop"}}`,
+			want: 7,
+		},
+		{
+			name: "callback without a message",
+			raw:  `{"update_id":1,"callback_query":{"id":"1","from":{"id":5},"data":"noop"}}`,
+		},
+		{
+			name: "private chat",
+			raw:  `{"update_id":1,"message":{"message_id":1,"chat":{"id":5},"text":"/status"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u botUpdate
+			if err := json.Unmarshal([]byte(tt.raw), &u); err != nil {
+				t.Fatal(err)
+			}
+			if u.UpdateID != 1 {
+				t.Errorf("the update is not decoded: %+v", u.Update)
+			}
+			if u.ThreadID != tt.want {
+				t.Errorf("ThreadID = %d, want %d", u.ThreadID, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCallbackAck(t *testing.T) {
+	configured := Profile{Citizenship: "Ukraine", PeopleNumber: "1", Service: "blue-card"}
+	subscribed := Profile{Citizenship: "India", PeopleNumber: "2", Service: "blue-card"}
+
+	const (
+		admin      = 1
+		subscriber = 2
+		stranger   = 3
+		escalation = 4
+	)
+
+	tests := []struct {
+		name   string
+		chatID int64
+		alert  Profile
+		answer string
+		acked  bool
+	}{
+		{name: "admin", chatID: admin, alert: configured, answer: "Acknowledged", acked: true},
+		{name: "escalation recipient", chatID: escalation, alert: configured, answer: "Acknowledged", acked: true},
+		{name: "subscriber of the profile", chatID: subscriber, alert: subscribed, answer: "Acknowledged", acked: true},
+		{name: "subscriber of another profile", chatID: subscriber, alert: configured, answer: "You are not allowed to acknowledge this alert"},
+		{name: "stranger", chatID: stranger, alert: configured, answer: "You are not allowed to acknowledge this alert"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, tb := newTestBot(t)
+			r := &Runner{
+				botClient:    bot,
+				logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				adminChatIDs: []int64{admin},
+				subs:         &subscriptions{byChat: map[int64]Profile{subscriber: subscribed}},
+			}
+			r.register(&telegramNotifier{r: r, to: TelegramRecipient{ChatID: escalation}, escalationOnly: true})
+			r.state.Alerts = []*alert{{ID: "a1", Data: messageData{Result: Result{Profile: tt.alert}}}}
+
+			r.handleCallback(newTestCallback(tt.chatID, tt.chatID, callbackAck+":a1"), 0)
+
+			if got := tb.answers(); len(got) != 1 || got[0] != tt.answer {
+				t.Errorf("answers = %q, want %q", got, tt.answer)
+			}
+			if acked := len(r.state.Alerts) == 0; acked != tt.acked {
+				t.Errorf("the alert is acknowledged: %v, want %v", acked, tt.acked)
+			}
+		})
+	}
+}
@@ -0,0 +1,420 @@
+package prufen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// minCommandInterval is the lowest poll interval which could be set by the bot.
+	minCommandInterval = time.Second * 30
+
+	defaultHistoryCount = 10
+	defaultLogsCount    = 20
+
+	// maxMessageLength is the limit of a text message length in runes.
+	maxMessageLength = 4096
+)
+
+// botCommands are registered as the bot menu.
+var botCommands = []tgbotapi.BotCommand{
+	{Command: "status", Description: "Show the last result, the next run and the error streak"},
+	{Command: "check", Description: "Check for slots right now, optionally of a single watch, e.g. /check family"},
+	{Command: "pause", Description: "Pause polling, optionally of a single watch"},
+	{Command: "resume", Description: "Resume polling, optionally of a single watch"},
+	{Command: "interval", Description: "Show or set the poll interval, e.g. /interval 2m or /interval family 5m"},
+	{Command: "screenshot", Description: "Check for slots right now and show the final page, optionally of a single watch"},
+	{Command: "history", Description: "List the last runs, e.g. /history 20"},
+	{Command: "logs", Description: "Show the recent warnings and errors, e.g. /logs 50"},
+}
+
+// subscriptionCommands are available to everyone if subscriptions are enabled.
+var subscriptionCommands = []tgbotapi.BotCommand{
+	{Command: "subscribe", Description: "Subscribe to slots for your citizenship and service"},
+	{Command: "subscription", Description: "Show your subscription"},
+	{Command: "unsubscribe", Description: "Stop notifications"},
+}
+
+// registerCommands sets the bot menu, failures are not critical.
+func (r *Runner) registerCommands() {
+	commands := botCommands
+	if r.subscriptionsEnabled {
+		commands = append(subscriptionCommands, botCommands...)
+	}
+
+	if _, err := r.botClient.Request(tgbotapi.NewSetMyCommands(commands...)); err != nil {
+		r.logger.Warn("failed to register bot commands", "error", err)
+	}
+}
+
+// authorized reports whether the message came from an admin chat or user.
+func (r *Runner) authorized(msg *tgbotapi.Message) bool {
+	return r.authorizedChat(msg.Chat.ID, msg.From)
+}
+
+// authorizedChat reports whether the chat or the user is an admin one.
+func (r *Runner) authorizedChat(chatID int64, from *tgbotapi.User) bool {
+	for _, id := range r.adminChatIDs {
+		if id == chatID || (from != nil && id == from.ID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Runner) handleCommand(msg *tgbotapi.Message) {
+	for _, c := range subscriptionCommands {
+		if c.Command == msg.Command() {
+			r.handleSubscriptionCommand(msg)
+			return
+		}
+	}
+
+	if !r.authorized(msg) {
+		if r.subscriptionsEnabled {
+			r.reply(msg, r.commandsHelp(subscriptionCommands))
+			return
+		}
+
+		r.logger.Warn("unauthorized bot command", "command", msg.Command(), "chat", msg.Chat.ID, "from", msg.From.String())
+		r.reply(msg, "You are not allowed to control this bot")
+		return
+	}
+
+	r.logger.Info("bot command", "command", msg.Command(), "chat", msg.Chat.ID, "from", msg.From.String())
+
+	switch msg.Command() {
+	case "status":
+		r.reply(msg, r.describeStatus())
+
+	case "check", "screenshot":
+		watches, _, ok := r.watchArgument(msg)
+		if !ok {
+			return
+		}
+
+		screenshot := msg.Command() == "screenshot"
+		queued := 0
+		for _, w := range watches {
+			w := w
+			ok := w.sched.requestCheck(func(results []Result) {
+				if screenshot {
+					r.replyWithScreenshots(msg, results)
+					return
+				}
+				r.reply(msg, r.watchPrefix(w)+r.describeResults(results))
+			})
+			if ok {
+				queued++
+			}
+		}
+		if queued == 0 {
+			r.reply(msg, "A check has already been requested")
+			return
+		}
+		r.reply(msg, "Checking...")
+
+	case "pause":
+		watches, _, ok := r.watchArgument(msg)
+		if !ok {
+			return
+		}
+
+		if !r.setPaused(watches, true) {
+			r.reply(msg, "Polling is already paused")
+			return
+		}
+		r.reply(msg, "Polling is paused")
+
+	case "resume":
+		watches, _, ok := r.watchArgument(msg)
+		if !ok {
+			return
+		}
+
+		// booked profiles are checked again on resume
+		if !r.setPaused(watches, false) {
+			r.reply(msg, "Polling is not paused")
+			return
+		}
+		r.reply(msg, "Polling is resumed")
+
+	case "interval":
+		watches, arg, ok := r.watchArgument(msg)
+		if !ok {
+			return
+		}
+		if arg == "" {
+			lines := make([]string, 0, len(watches))
+			for _, w := range watches {
+				lines = append(lines, r.watchPrefix(w)+"Poll interval is "+w.sched.status().Interval.String())
+			}
+			r.reply(msg, strings.Join(lines, "\n"))
+			return
+		}
+
+		interval, err := time.ParseDuration(arg)
+		if err != nil || interval < minCommandInterval {
+			r.reply(msg, fmt.Sprintf("Invalid interval %q, should be a duration not less than %s, e.g. 2m", arg, minCommandInterval))
+			return
+		}
+		for _, w := range watches {
+			w.sched.setInterval(interval)
+			r.stateChanged(w, "interval")
+		}
+		r.saveSchedulers()
+		r.reply(msg, "Poll interval is set to "+interval.String())
+
+	case "history":
+		n, ok := r.countArgument(msg, defaultHistoryCount, historySize)
+		if !ok {
+			return
+		}
+
+		runs := r.history(r.watches, n)
+		if len(runs) == 0 {
+			r.reply(msg, "No runs yet")
+			return
+		}
+
+		multi := false
+		for _, res := range runs {
+			multi = multi || res.Profile.key() != runs[0].Profile.key()
+		}
+
+		lines := make([]string, 0, len(runs))
+		for _, res := range runs {
+			line := res.StartedAt.Format(time.DateTime) + " "
+			if multi {
+				p := res.Profile
+				line += fmt.Sprintf("%s, %s people, %s: ", p.Citizenship, p.PeopleNumber, p.Service)
+			}
+			lines = append(lines, line+describeResult(res))
+		}
+		r.reply(msg, tailText(strings.Join(lines, "\n"), maxMessageLength))
+
+	case "logs":
+		n, ok := r.countArgument(msg, defaultLogsCount, recentLogsSize)
+		if !ok {
+			return
+		}
+
+		entries := r.logs.tail(n)
+		if len(entries) == 0 {
+			r.reply(msg, "No warnings or errors")
+			return
+		}
+		r.reply(msg, tailText(strings.Join(entries, "\n"), maxMessageLength))
+
+	default:
+		commands := botCommands
+		if r.subscriptionsEnabled {
+			commands = append(subscriptionCommands, botCommands...)
+		}
+		r.reply(msg, r.commandsHelp(commands))
+	}
+}
+
+// watchArgument selects the watches by the optional name in the first
+// command argument, all of them if there is none. It returns the rest
+// of the arguments, it replies and returns false if the watch is unknown.
+func (r *Runner) watchArgument(msg *tgbotapi.Message) ([]*watch, string, bool) {
+	arg := strings.TrimSpace(msg.CommandArguments())
+	name, rest, _ := strings.Cut(arg, " ")
+
+	// the first argument is not a name if it's a value, e.g. /interval 2m
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return r.watches, arg, true
+	}
+
+	watches, err := r.selectWatches(name)
+	if err != nil {
+		names := make([]string, 0, len(r.watches))
+		for _, w := range r.watches {
+			names = append(names, w.name)
+		}
+		r.reply(msg, fmt.Sprintf("Unknown watch %q, should be one of: %s", name, strings.Join(names, ", ")))
+		return nil, "", false
+	}
+
+	return watches, strings.TrimSpace(rest), true
+}
+
+// watchPrefix prefixes replies about the watch if there are several of them.
+func (r *Runner) watchPrefix(w *watch) string {
+	if len(r.watches) < 2 {
+		return ""
+	}
+
+	return "[" + w.name + "] "
+}
+
+// countArgument parses the optional count argument of the command,
+// it replies and returns false if the argument is invalid.
+func (r *Runner) countArgument(msg *tgbotapi.Message, def, limit int) (int, bool) {
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg == "" {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > limit {
+		r.reply(msg, fmt.Sprintf("Invalid count %q, should be a number from 1 to %d", arg, limit))
+		return 0, false
+	}
+
+	return n, true
+}
+
+// replyWithScreenshots sends the screenshot of each result as a reply to the message.
+func (r *Runner) replyWithScreenshots(msg *tgbotapi.Message, results []Result) {
+	if len(results) == 0 {
+		r.reply(msg, r.describeResults(results))
+		return
+	}
+
+	for _, res := range results {
+		caption := r.describeResults([]Result{res})
+		if len(res.Screenshot) == 0 {
+			r.reply(msg, caption+"\nNo screenshot has been taken")
+			continue
+		}
+
+		photo := tgbotapi.NewPhoto(msg.Chat.ID, tgbotapi.FileBytes{Name: "screenshot.jpeg", Bytes: res.Screenshot})
+		photo.Caption = tailText(caption, maxCaptionLength)
+		photo.ReplyToMessageID = msg.MessageID
+		photo.AllowSendingWithoutReply = true
+
+		if _, err := r.botClient.Send(photo); err != nil {
+			r.logger.Error("failed to reply with screenshot", "chat", msg.Chat.ID, "error", err)
+		}
+	}
+}
+
+// tailText cuts the beginning of the text to fit into the limit of runes.
+func tailText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	return "…" + string(runes[len(runes)-limit+1:])
+}
+
+func (r *Runner) commandsHelp(commands []tgbotapi.BotCommand) string {
+	var sb strings.Builder
+	sb.WriteString("Available commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&sb, "/%s - %s\n", c.Command, c.Description)
+	}
+
+	return sb.String()
+}
+
+// reply sends a plain text reply to the message.
+func (r *Runner) reply(msg *tgbotapi.Message, text string) {
+	msgcfg := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgcfg.ReplyToMessageID = msg.MessageID
+	msgcfg.AllowSendingWithoutReply = true
+	msgcfg.DisableWebPagePreview = true
+
+	if _, err := r.botClient.Send(msgcfg); err != nil {
+		r.logger.Error("failed to reply to bot command", "chat", msg.Chat.ID, "error", err)
+	}
+}
+
+func (r *Runner) describeStatus() string {
+	return r.describeWatchesStatus(r.watches)
+}
+
+// describeWatchesStatus describes the status of the given watches only.
+func (r *Runner) describeWatchesStatus(watches []*watch) string {
+	parts := make([]string, 0, len(watches))
+	for _, w := range watches {
+		text := r.describeWatchStatus(w)
+		if len(r.watches) > 1 {
+			text = "Watch " + w.name + ":\n" + text
+		}
+		parts = append(parts, text)
+	}
+
+	if now := time.Now(); !r.officeHours.open(now) {
+		text := "The office is closed"
+		if holiday, ok := berlinHoliday(now); ok {
+			text += " for " + holiday
+		}
+		if next := r.officeHours.nextOpening(now); !next.IsZero() {
+			text += ", next business day is " + next.Format("Monday, 2 January 15:04")
+		}
+		parts = append(parts, text)
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+func (r *Runner) describeWatchStatus(w *watch) string {
+	st := w.sched.status()
+
+	var sb strings.Builder
+	switch {
+	case st.Paused:
+		sb.WriteString("Polling is paused\n")
+	case st.NextRun.IsZero():
+		sb.WriteString("No runs are scheduled\n")
+	default:
+		fmt.Fprintf(&sb, "Next run at %s (in %s)\n", st.NextRun.Format(time.DateTime), time.Until(st.NextRun).Round(time.Second))
+	}
+	fmt.Fprintf(&sb, "Poll interval: %s\n", st.Interval)
+	if st.CurrentInterval != st.Interval {
+		if st.CurrentInterval == 0 {
+			sb.WriteString("Polling is off by the schedule now\n")
+		} else {
+			fmt.Fprintf(&sb, "Poll interval by the schedule now: %s\n", st.CurrentInterval)
+		}
+	}
+	fmt.Fprintf(&sb, "Error streak: %d\n", st.ErrorStreak)
+	if st.Breaker != breakerClosed {
+		sb.WriteString("The ABH site keeps failing, only probes are run\n")
+	}
+
+	if len(st.LastResults) == 0 {
+		sb.WriteString("No runs yet")
+	} else {
+		fmt.Fprintf(&sb, "Last run at %s:\n%s", st.LastResults[0].StartedAt.Format(time.DateTime), r.describeResults(st.LastResults))
+	}
+
+	return sb.String()
+}
+
+func (r *Runner) describeResults(results []Result) string {
+	if len(results) == 0 {
+		return "Nothing to check, no profiles are configured or subscribed to"
+	}
+	if len(results) == 1 {
+		return describeResult(results[0])
+	}
+
+	lines := make([]string, 0, len(results))
+	for _, res := range results {
+		p := res.Profile
+		lines = append(lines, fmt.Sprintf("%s, %s people, %s: %s", p.Citizenship, p.PeopleNumber, p.Service, describeResult(res)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func describeResult(res Result) string {
+	switch {
+	case res.Error != "":
+		return fmt.Sprintf("failed in %.1fs: %s", res.Duration.Seconds(), res.Error)
+	case res.SlotsAvailable:
+		return fmt.Sprintf("slots are available! Proceed further: %s", res.URL)
+	default:
+		return fmt.Sprintf("no slots are available, checked in %.1fs", res.Duration.Seconds())
+	}
+}
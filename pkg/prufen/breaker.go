@@ -0,0 +1,89 @@
+package prufen
+
+import (
+	"fmt"
+	"time"
+)
+
+type (
+	// ErrorBackoff slows polling down while polls keep failing, and opens
+	// the circuit breaker after too many of them. Only probe polls are run
+	// while the breaker is open, the first successful one closes it.
+	// A poll fails if runs of all of its profiles have failed.
+	ErrorBackoff struct {
+		// MaxInterval caps the interval which is doubled after each
+		// failed poll, defaults to the DefaultErrorBackoffMax.
+		MaxInterval time.Duration
+		// BreakerThreshold is the number of consecutive failed polls to open
+		// the breaker after, defaults to the DefaultBreakerThreshold.
+		BreakerThreshold int
+		// ProbeInterval is the interval of probe polls while the breaker
+		// is open, defaults to the DefaultBreakerProbeInterval.
+		ProbeInterval time.Duration
+	}
+
+	// breakerState is the state of the circuit breaker around polls.
+	breakerState string
+)
+
+const (
+	breakerClosed breakerState = "closed"
+	breakerOpen   breakerState = "open"
+	// breakerHalfOpen is the state of a probe poll.
+	breakerHalfOpen breakerState = "half_open"
+)
+
+var breakerStates = []breakerState{breakerClosed, breakerOpen, breakerHalfOpen}
+
+func (b ErrorBackoff) validate() error {
+	if b.MaxInterval < 0 || b.ProbeInterval < 0 || b.BreakerThreshold < 0 {
+		return fmt.Errorf("negative values are not allowed")
+	}
+
+	return nil
+}
+
+// interval returns the interval after the given number of consecutive
+// failed polls in the state.
+func (b ErrorBackoff) interval(iv time.Duration, failures int, state breakerState) time.Duration {
+	if state != breakerClosed {
+		return b.ProbeInterval
+	}
+
+	for i := 0; i < failures && iv < b.MaxInterval; i++ {
+		iv *= 2
+	}
+	if failures > 0 && iv > b.MaxInterval {
+		return b.MaxInterval
+	}
+
+	return iv
+}
+
+// setBreakerMetric exposes the current state of the breaker of the watch.
+func setBreakerMetric(watch string, state breakerState) {
+	for _, s := range breakerStates {
+		v := 0.
+		if s == state {
+			v = 1
+		}
+		breakerStateGauge.WithLabelValues(watch, string(s)).Set(v)
+	}
+}
+
+// notifyBreaker sends the operator alert about the breaker state change of the watch.
+func (r *Runner) notifyBreaker(w *watch, kind NotificationKind, failures int, results []Result) {
+	data := messageData{Kind: kind, Failures: failures}
+	if len(results) > 0 {
+		data.Result = results[0]
+		data.Screenshot = nil
+	}
+
+	if kind == KindBreakerOpen {
+		r.logger.Warn("circuit breaker is open, polls keep failing", "watch", w.name, "failures", failures, "error", data.Error)
+	} else {
+		r.logger.Info("circuit breaker is closed", "watch", w.name, "failures", failures)
+	}
+
+	r.notify(data, r.operatorTargets(w))
+}
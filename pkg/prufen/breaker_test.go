@@ -0,0 +1,122 @@
+package prufen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerBreaker(t *testing.T) {
+	backoff := ErrorBackoff{
+		MaxInterval:      time.Minute * 10,
+		BreakerThreshold: 3,
+		ProbeInterval:    time.Minute * 30,
+	}
+
+	type step struct {
+		// start marks a poll start instead of its results.
+		start bool
+		// results of the poll: "fail", "ok", or none if it has been skipped.
+		results  string
+		breaker  breakerState
+		kind     NotificationKind
+		failures int
+		// interval is the time until the next poll, checked if set.
+		interval time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "threshold",
+			steps: []step{
+				{results: "fail", breaker: breakerClosed, failures: 1, interval: time.Minute * 2},
+				{results: "fail", breaker: breakerClosed, failures: 2, interval: time.Minute * 4},
+				{results: "fail", breaker: breakerOpen, kind: KindBreakerOpen, failures: 3, interval: backoff.ProbeInterval},
+			},
+		},
+		{
+			name: "failures are reset",
+			steps: []step{
+				{results: "fail", breaker: breakerClosed, failures: 1},
+				{results: "fail", breaker: breakerClosed, failures: 2},
+				{results: "ok", breaker: breakerClosed, failures: 2, interval: time.Minute},
+				{results: "fail", breaker: breakerClosed, failures: 1},
+				{results: "fail", breaker: breakerClosed, failures: 2},
+			},
+		},
+		{
+			name: "failed probe",
+			steps: []step{
+				{results: "fail", failures: 1},
+				{results: "fail", failures: 2},
+				{results: "fail", breaker: breakerOpen, kind: KindBreakerOpen, failures: 3},
+				{start: true, breaker: breakerHalfOpen},
+				{results: "fail", breaker: breakerOpen, failures: 4, interval: backoff.ProbeInterval},
+				{start: true, breaker: breakerHalfOpen},
+				{results: "", breaker: breakerOpen, interval: backoff.ProbeInterval},
+			},
+		},
+		{
+			name: "recovery",
+			steps: []step{
+				{results: "fail", failures: 1},
+				{results: "fail", failures: 2},
+				{results: "fail", breaker: breakerOpen, kind: KindBreakerOpen, failures: 3},
+				{start: true, breaker: breakerHalfOpen},
+				{results: "ok", breaker: breakerClosed, kind: KindBreakerClosed, failures: 3, interval: time.Minute},
+				{results: "fail", breaker: breakerClosed, failures: 1},
+			},
+		},
+	}
+
+	p := Profile{Citizenship: "Ukraine", PeopleNumber: "1"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScheduler("test", time.Minute, nil, nil, 0, backoff)
+			for i, st := range tt.steps {
+				if st.start {
+					s.started(time.Now())
+				} else {
+					var results []Result
+					switch st.results {
+					case "fail":
+						results = []Result{{Profile: p, Error: "failed"}}
+					case "ok":
+						results = []Result{{Profile: p}}
+					}
+
+					kind, failures := s.finished(results)
+					if kind != st.kind || failures != st.failures {
+						t.Fatalf("step #%d: finished() = %q, %d, want %q, %d", i, kind, failures, st.kind, st.failures)
+					}
+				}
+
+				if st.breaker != "" && s.breaker != st.breaker {
+					t.Fatalf("step #%d: the breaker is %s, want %s", i, s.breaker, st.breaker)
+				}
+				if st.interval != 0 {
+					s.lastStart = time.Now()
+					if got := s.nextRun().Sub(s.lastStart); got != st.interval {
+						t.Fatalf("step #%d: the next poll in %s, want %s", i, got, st.interval)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNotifyLevelIncludes(t *testing.T) {
+	for _, kind := range []NotificationKind{KindSlots, KindEscalation, KindBreakerOpen, KindBreakerClosed} {
+		for _, l := range []NotifyLevel{LevelSlots, LevelErrors, LevelDebug} {
+			if !l.includes(kind) {
+				t.Errorf("the %s level does not include %s", l, kind)
+			}
+		}
+	}
+
+	if LevelSlots.includes(KindError) {
+		t.Error("the slots level includes errors")
+	}
+}
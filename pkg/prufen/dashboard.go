@@ -0,0 +1,33 @@
+package prufen
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardFS holds the static files of the web dashboard, which is built
+// on top of the JSON API.
+//
+//go:embed dashboard
+var dashboardFS embed.FS
+
+// dashboardHandler serves the dashboard files.
+func dashboardHandler() http.Handler {
+	sub, err := fs.Sub(dashboardFS, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.FileServer(http.FS(sub))
+}
+
+// handleRoot redirects to the dashboard, other unknown paths are not found.
+func handleRoot(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+
+	http.Redirect(w, req, "/dashboard/", http.StatusFound)
+}
@@ -0,0 +1,169 @@
+"use strict";
+
+// the dashboard is served under /dashboard/, the API is relative to it
+// to work behind a proxy with a path prefix
+const api = "../api/v1";
+const refreshInterval = 10000;
+// events come in bursts during a run, refresh once they settle down
+const eventsDebounce = 500;
+const runsLimit = 100;
+
+const el = (id) => document.getElementById(id);
+
+function node(tag, attrs, ...children) {
+  const n = document.createElement(tag);
+  Object.entries(attrs || {}).forEach(([k, v]) => n.setAttribute(k, v));
+  children.forEach((c) => n.append(c));
+  return n;
+}
+
+// durations are nanoseconds in the API
+const seconds = (ns) => (ns / 1e9).toFixed(1) + "s";
+const minutes = (ns) => (ns >= 6e10 ? Math.round(ns / 6e10) + "m" : seconds(ns));
+const datetime = (s) => (s && !s.startsWith("0001") ? new Date(s).toLocaleString() : "–");
+
+function profileName(p) {
+  if (!p) {
+    return "subscribers";
+  }
+  return `${p.citizenship}, ${p.people_number} people${p.service ? ", " + p.service : ""}`;
+}
+
+function outcome(run) {
+  if (run.error) {
+    return node("span", { class: "error" }, "failed: " + run.error);
+  }
+  if (run.slots_available) {
+    return node("span", { class: "slots" }, "slots are available");
+  }
+  return "no slots";
+}
+
+function watchCard(w) {
+  const rows = [
+    ["Polling", w.paused ? "paused" : w.current_interval === 0 ? "off by the schedule" : "active"],
+    ["Next run", w.paused ? "–" : datetime(w.next_run)],
+    ["Interval", minutes(w.interval) + (w.current_interval && w.current_interval !== w.interval ? `, ${minutes(w.current_interval)} now` : "")],
+    ["Error streak", String(w.error_streak)],
+    ["Breaker", w.breaker],
+  ];
+
+  const dl = node("dl");
+  rows.forEach(([k, v]) => dl.append(node("dt", {}, k), node("dd", {}, v)));
+
+  const pause = node("button", { "data-action": w.paused ? "resume" : "pause", "data-method": "POST", "data-watch": w.name }, w.paused ? "Resume" : "Pause");
+  const check = node("button", { "data-action": "runs", "data-method": "POST", "data-watch": w.name }, "Check now");
+
+  return node("div", { class: "card" }, node("h3", {}, w.name), node("p", {}, profileName(w.profile)), dl, check, pause);
+}
+
+async function getJSON(path) {
+  const resp = await fetch(api + path);
+  if (!resp.ok) {
+    throw new Error(`${path}: ${resp.status}`);
+  }
+  return resp.json();
+}
+
+async function refresh() {
+  try {
+    const [status, runs, artifacts] = await Promise.all([
+      getJSON("/status"),
+      getJSON(`/runs?limit=${runsLimit}`),
+      getJSON("/artifacts"),
+    ]);
+    renderStatus(status);
+    renderRuns(runs.runs || []);
+    renderGallery(artifacts.artifacts || []);
+  } catch (err) {
+    showMessage("Failed to refresh: " + err.message);
+  }
+}
+
+function renderStatus(status) {
+  let office = status.office_open ? "The office is open" : "The office is closed";
+  if (status.holiday) {
+    office += ` for ${status.holiday}`;
+  }
+  if (!status.office_open && status.next_business_day) {
+    office += `, next business day is ${datetime(status.next_business_day)}`;
+  }
+  el("office").textContent = office;
+  el("watches").replaceChildren(...status.watches.map(watchCard));
+}
+
+function renderRuns(runs) {
+  el("runs").replaceChildren(...runs.map((run) =>
+    node("tr", {}, node("td", {}, datetime(run.started_at)), node("td", {}, profileName(run.profile)), node("td", {}, outcome(run)), node("td", {}, seconds(run.duration)))));
+
+  const found = runs.filter((run) => run.slots_available);
+  el("findings").replaceChildren(...(found.length ? found.map((run) => {
+    const link = node("a", { href: run.url, target: "_blank", rel: "noopener" }, "proceed");
+    return node("li", {}, `${datetime(run.started_at)}, ${profileName(run.profile)}: `, link);
+  }) : [node("li", {}, "No slots were found recently")]));
+}
+
+function renderGallery(artifacts) {
+  el("gallery").replaceChildren(...artifacts.map((a) => {
+    const src = `${api}/artifacts/${a.id}`;
+    const img = node("a", { href: src, target: "_blank" }, node("img", { src, alt: "screenshot", loading: "lazy" }));
+    const caption = node("figcaption", {}, `${datetime(a.started_at)}, ${profileName(a.profile)}: `, outcome(a));
+    return node("figure", {}, img, caption);
+  }));
+}
+
+function showMessage(text) {
+  const msg = el("message");
+  msg.textContent = text;
+  msg.hidden = false;
+  setTimeout(() => { msg.hidden = true; }, 5000);
+}
+
+document.addEventListener("click", async (event) => {
+  const button = event.target.closest("button[data-action]");
+  if (!button) {
+    return;
+  }
+
+  const watch = button.dataset.watch ? "?watch=" + encodeURIComponent(button.dataset.watch) : "";
+  // the Authorization header also makes cross-origin requests preflighted
+  const headers = { Authorization: "Bearer " + el("token").value };
+  const resp = await fetch(`${api}/${button.dataset.action}${watch}`, { method: button.dataset.method, headers });
+  const body = await resp.json().catch(() => ({}));
+  if (resp.status === 401) {
+    showMessage("Enter the API token to " + button.textContent.toLowerCase());
+  } else if (!resp.ok) {
+    showMessage(body.error || `Request failed: ${resp.status}`);
+  } else if (button.dataset.action === "runs") {
+    showMessage("Checking, the results will show up shortly");
+  }
+  refresh();
+});
+
+// the token is kept in the browser only
+el("token").value = localStorage.getItem("token") || "";
+el("token").addEventListener("change", () => localStorage.setItem("token", el("token").value));
+
+let pending;
+function refreshSoon() {
+  clearTimeout(pending);
+  pending = setTimeout(refresh, eventsDebounce);
+}
+
+// the browser resumes the stream with the Last-Event-ID on reconnect,
+// the interval refresh is a fallback if the stream is unavailable
+if (window.EventSource) {
+  const events = new EventSource(api + "/events");
+  ["outcome", "notification_sent", "state_changed"].forEach((type) => events.addEventListener(type, refreshSoon));
+  events.addEventListener("error", (event) => {
+    // the runner errors are events with data, unlike the connection errors
+    if (event.data) {
+      const ev = JSON.parse(event.data);
+      showMessage("Error: " + ev.data.error);
+      refreshSoon();
+    }
+  });
+}
+
+refresh();
+setInterval(refresh, refreshInterval);
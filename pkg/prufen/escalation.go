@@ -0,0 +1,171 @@
+package prufen
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// escalationCheckInterval is the precision of escalation steps.
+const escalationCheckInterval = time.Second * 5
+
+type (
+	// EscalationPolicy re-sends alerts about available slots until
+	// someone acknowledges them with the bot button or the HTTP API.
+	EscalationPolicy struct {
+		// Steps are taken one by one while the alert is not acknowledged.
+		Steps []EscalationStep
+	}
+
+	// EscalationStep is a single re-send of the alert with a higher urgency.
+	EscalationStep struct {
+		// After is the duration since the alert was raised to take the step at.
+		After time.Duration
+		// Recipients get the escalated alert, recipients of
+		// the original alert get it if empty.
+		Recipients []TelegramRecipient
+	}
+
+	// alert is an unacknowledged notification about available slots.
+	alert struct {
+		ID       string      `json:"id"`
+		Data     messageData `json:"data"`
+		RaisedAt time.Time   `json:"raised_at"`
+		// Steps is the number of taken escalation steps.
+		Steps int `json:"steps,omitempty"`
+	}
+)
+
+func (p EscalationPolicy) validate() error {
+	for i, step := range p.Steps {
+		if step.After <= 0 {
+			return fmt.Errorf("step #%d: non-positive duration %s", i, step.After)
+		}
+		if i > 0 && step.After <= p.Steps[i-1].After {
+			return fmt.Errorf("step #%d: duration %s is not after the previous step", i, step.After)
+		}
+		for _, rc := range step.Recipients {
+			if rc.ChatID == 0 {
+				return fmt.Errorf("step #%d: recipient has no chat ID", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// raiseAlert starts tracking the acknowledgement of the notification
+// and returns the alert ID. Must be called with the stateMu held.
+func (r *Runner) raiseAlert(data messageData) string {
+	id := make([]byte, 6)
+	_, _ = rand.Read(id)
+
+	a := &alert{
+		ID:       hex.EncodeToString(id),
+		Data:     data,
+		RaisedAt: data.StartedAt,
+	}
+	a.Data.AlertID = a.ID
+	a.Data.Screenshot = nil
+
+	r.state.Alerts = append(r.state.Alerts, a)
+
+	return a.ID
+}
+
+// ackAlert acknowledges the alert and stops its escalation,
+// it returns false if there is no such an open alert.
+func (r *Runner) ackAlert(id, by string) bool {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	for i, a := range r.state.Alerts {
+		if a.ID != id {
+			continue
+		}
+
+		r.state.Alerts = append(r.state.Alerts[:i], r.state.Alerts[i+1:]...)
+		r.saveState()
+		r.logger.Info("alert acknowledged", "alert", id, "by", by, "escalation steps", a.Steps)
+
+		return true
+	}
+
+	return false
+}
+
+// closeAlerts stops escalation of the profile alerts.
+// Must be called with the stateMu held.
+func (r *Runner) closeAlerts(p Profile) {
+	open := r.state.Alerts[:0]
+	for _, a := range r.state.Alerts {
+		if a.Data.Profile.key() != p.key() {
+			open = append(open, a)
+		}
+	}
+	r.state.Alerts = open
+}
+
+// escalate takes due escalation steps until the context is done.
+func (r *Runner) escalate(ctx context.Context) {
+	ticker := time.NewTicker(escalationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.escalateDue(now)
+		}
+	}
+}
+
+func (r *Runner) escalateDue(now time.Time) {
+	type escalation struct {
+		data messageData
+		step EscalationStep
+	}
+
+	var due []escalation
+
+	r.stateMu.Lock()
+	for _, a := range r.state.Alerts {
+		if a.Steps >= len(r.escalation.Steps) {
+			continue
+		}
+
+		step := r.escalation.Steps[a.Steps]
+		if now.Sub(a.RaisedAt) < step.After {
+			continue
+		}
+
+		a.Steps++
+		data := a.Data
+		data.Kind, data.Urgency = KindEscalation, a.Steps
+		due = append(due, escalation{data: data, step: step})
+	}
+	if len(due) > 0 {
+		r.saveState()
+	}
+	r.stateMu.Unlock()
+
+	for _, e := range due {
+		r.logger.Warn("escalating unacknowledged alert", "alert", e.data.AlertID, "urgency", e.data.Urgency)
+
+		if len(e.step.Recipients) == 0 {
+			r.notify(e.data, r.targets(e.data.Profile))
+			continue
+		}
+
+		var ids []string
+		for _, rc := range e.step.Recipients {
+			ids = append(ids, (&telegramNotifier{to: rc}).id())
+		}
+		if err := r.outbox.enqueue(ids, e.data); err != nil {
+			r.logger.Error("failed to persist notification", "notifiers", ids, "error", err)
+		}
+	}
+}
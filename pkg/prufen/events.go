@@ -0,0 +1,244 @@
+package prufen
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// eventsBacklogSize is the number of the last events kept
+	// for clients resuming with the Last-Event-ID.
+	eventsBacklogSize = 500
+	// eventsBufferSize is the number of events a client could lag behind,
+	// slower clients are disconnected and have to resume.
+	eventsBufferSize = 64
+	// eventsKeepAlive is the interval of comments keeping idle streams open.
+	eventsKeepAlive = time.Second * 15
+	// eventsEpochShift places the start time of the process in the high bits
+	// of event IDs, so they keep growing across restarts while staying within
+	// the integers JSON clients represent exactly.
+	eventsEpochShift = 20
+)
+
+// eventType distinguishes events of the stream.
+type eventType string
+
+const (
+	eventRunStarted       eventType = "run_started"
+	eventStepCompleted    eventType = "step_completed"
+	eventOutcome          eventType = "outcome"
+	eventNotificationSent eventType = "notification_sent"
+	eventError            eventType = "error"
+	eventStateChanged     eventType = "state_changed"
+)
+
+type (
+	// event is a single event of the runner activity.
+	event struct {
+		ID   uint64    `json:"id"`
+		Type eventType `json:"type"`
+		Time time.Time `json:"time"`
+		Data any       `json:"data,omitempty"`
+	}
+
+	// outcomeEvent is the data of the outcome event, the screenshot is only
+	// flagged, so the backlog does not keep images.
+	outcomeEvent struct {
+		Result
+		HasScreenshot bool `json:"has_screenshot"`
+	}
+
+	// eventBus fans events out to the stream clients and keeps the backlog,
+	// the zero value is ready to use.
+	eventBus struct {
+		mu sync.Mutex
+		// epoch is the first ID of the process, IDs below it are
+		// from before a restart.
+		epoch   uint64
+		seq     uint64
+		backlog []event
+		clients map[chan event]struct{}
+	}
+)
+
+// init seeds the sequence with the epoch of the process,
+// must be called with the mu held.
+func (b *eventBus) init() {
+	if b.epoch == 0 {
+		b.epoch = uint64(time.Now().Unix()) << eventsEpochShift
+		b.seq = b.epoch
+	}
+}
+
+// publish sends the event to every client, clients which lag behind
+// are disconnected.
+func (b *eventBus) publish(typ eventType, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.init()
+	b.seq++
+	ev := event{ID: b.seq, Type: typ, Time: time.Now(), Data: data}
+
+	b.backlog = append(b.backlog, ev)
+	if len(b.backlog) > eventsBacklogSize {
+		b.backlog = append([]event(nil), b.backlog[len(b.backlog)-eventsBacklogSize:]...)
+	}
+
+	for ch := range b.clients {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the events after the given ID from the backlog
+// and the channel of the following ones. An ID out of the epoch of
+// the process comes from before a restart, so the whole backlog is missed.
+func (b *eventBus) subscribe(lastID uint64) ([]event, chan event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.init()
+	if lastID < b.epoch || lastID > b.seq {
+		lastID = 0
+	}
+
+	var missed []event
+	for _, ev := range b.backlog {
+		if ev.ID > lastID {
+			missed = append(missed, ev)
+		}
+	}
+
+	ch := make(chan event, eventsBufferSize)
+	if b.clients == nil {
+		b.clients = map[chan event]struct{}{}
+	}
+	b.clients[ch] = struct{}{}
+
+	return missed, ch
+}
+
+func (b *eventBus) unsubscribe(ch chan event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+// closeAll disconnects all of the clients, e.g. on the shutdown.
+func (b *eventBus) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.clients {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+// publishOutcome publishes the result of the run without its screenshot.
+func (r *Runner) publishOutcome(res Result) {
+	ev := outcomeEvent{Result: res, HasScreenshot: len(res.Screenshot) > 0}
+	ev.Screenshot = nil
+
+	r.events.publish(eventOutcome, ev)
+}
+
+// stateChanged publishes the state of the watch after the change.
+func (r *Runner) stateChanged(w *watch, reason string) {
+	r.events.publish(eventStateChanged, map[string]any{
+		"watch":  w.name,
+		"reason": reason,
+		"status": w.sched.status(),
+	})
+}
+
+// handleEvents streams the events with GET /api/v1/events as Server-Sent Events.
+// Clients resume with the Last-Event-ID header, or the "last_event_id" query
+// param, and get the missed events still in the backlog first.
+func (r *Runner) handleEvents(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	lastEventID := req.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = req.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid last event ID")
+			return
+		}
+	}
+
+	missed, ch := r.events.subscribe(lastID)
+	defer r.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, ev := range missed {
+		if err := writeEvent(w, ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				// the client lags behind or the server shuts down,
+				// it resumes on reconnect
+				return
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev event) error {
+	bb, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, bb)
+	return err
+}
@@ -0,0 +1,136 @@
+package prufen
+
+import "testing"
+
+// newTestEventBus returns the bus of the process started at the given second
+// with the number of events published.
+func newTestEventBus(startedAt uint64, published int) *eventBus {
+	b := &eventBus{epoch: startedAt << eventsEpochShift}
+	b.seq = b.epoch
+	for i := 0; i < published; i++ {
+		b.publish(eventRunStarted, nil)
+	}
+
+	return b
+}
+
+func TestEventBusSubscribe(t *testing.T) {
+	const startedAt = 1_700_000_000
+	epoch := uint64(startedAt) << eventsEpochShift
+
+	ids := func(from, to uint64) []uint64 {
+		var res []uint64
+		for id := from; id <= to; id++ {
+			res = append(res, epoch+id)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name   string
+		lastID uint64
+		want   []uint64
+	}{
+		{name: "new client", want: ids(1, 5)},
+		{name: "resuming", lastID: epoch + 3, want: ids(4, 5)},
+		{name: "up to date", lastID: epoch + 5},
+		{name: "resuming from before a restart", lastID: epoch - 42, want: ids(1, 5)},
+		{name: "resuming from before a restart of a long running process", lastID: epoch - 1<<eventsEpochShift + 3, want: ids(1, 5)},
+		{name: "ahead of the sequence", lastID: epoch + 42, want: ids(1, 5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestEventBus(startedAt, 5)
+			missed, ch := b.subscribe(tt.lastID)
+			defer b.unsubscribe(ch)
+
+			var got []uint64
+			for _, ev := range missed {
+				got = append(got, ev.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("missed events %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("missed events %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEventBusRestart(t *testing.T) {
+	// the client has seen 3 events of the previous process,
+	// the restarted one has published more events since
+	before := newTestEventBus(1_700_000_000, 3)
+	lastID := before.seq
+
+	after := newTestEventBus(1_700_000_060, 10)
+	missed, ch := after.subscribe(lastID)
+	defer after.unsubscribe(ch)
+
+	if len(missed) != 10 {
+		t.Fatalf("%d events are replayed, want the whole backlog of 10", len(missed))
+	}
+	if missed[0].ID <= lastID {
+		t.Errorf("the event #%d of the restarted process is not after #%d", missed[0].ID, lastID)
+	}
+}
+
+func TestEventBusZeroValue(t *testing.T) {
+	var b eventBus
+	b.publish(eventRunStarted, nil)
+
+	missed, ch := b.subscribe(0)
+	defer b.unsubscribe(ch)
+
+	if len(missed) != 1 || missed[0].ID != b.epoch+1 {
+		t.Fatalf("missed events %+v, want the first one of the epoch %d", missed, b.epoch)
+	}
+	if b.epoch>>eventsEpochShift == 0 {
+		t.Error("the epoch is not seeded")
+	}
+}
+
+func TestEventBusBacklogSize(t *testing.T) {
+	b := newTestEventBus(1_700_000_000, eventsBacklogSize+10)
+
+	missed, ch := b.subscribe(0)
+	defer b.unsubscribe(ch)
+
+	if len(missed) != eventsBacklogSize {
+		t.Fatalf("%d events are kept, want %d", len(missed), eventsBacklogSize)
+	}
+	if want := b.epoch + 11; missed[0].ID != want {
+		t.Errorf("the oldest kept event is #%d, want #%d", missed[0].ID, want)
+	}
+}
+
+func TestPublishOutcome(t *testing.T) {
+	r := &Runner{}
+	res := Result{Profile: Profile{Citizenship: "Ukraine"}, SlotsAvailable: true, Screenshot: []byte{0xff, 0xd8}}
+
+	r.publishOutcome(res)
+
+	missed, ch := r.events.subscribe(0)
+	defer r.events.unsubscribe(ch)
+
+	if len(missed) != 1 {
+		t.Fatalf("%d events are published, want 1", len(missed))
+	}
+	ev, ok := missed[0].Data.(outcomeEvent)
+	if !ok {
+		t.Fatalf("the outcome data is %T", missed[0].Data)
+	}
+	if ev.Screenshot != nil {
+		t.Error("the backlog keeps the screenshot")
+	}
+	if !ev.HasScreenshot || !ev.SlotsAvailable {
+		t.Errorf("the outcome is %+v, want slots with a screenshot", ev)
+	}
+	if len(res.Screenshot) == 0 {
+		t.Error("the screenshot of the result is dropped")
+	}
+}
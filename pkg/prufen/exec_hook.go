@@ -0,0 +1,107 @@
+package prufen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+type (
+	// ExecHook runs a local command for each notification. The command gets
+	// the notification as JSON on the stdin, and a few PRUFEN_* env variables.
+	ExecHook struct {
+		// Name identifies the hook, should be unique.
+		Name string
+		// Command is the executable with its arguments.
+		Command []string
+		// Timeout limits the command run, defaults to the DefaultExecHookTimeout.
+		Timeout time.Duration
+		// Kinds selects notifications to run the hook for, all if empty.
+		Kinds []NotificationKind
+	}
+
+	// execNotifier runs the hook's command.
+	execNotifier struct {
+		hook   ExecHook
+		logger *slog.Logger
+	}
+)
+
+func (h ExecHook) validate() error {
+	if h.Name == "" {
+		return errors.New("no name")
+	}
+	if len(h.Command) == 0 || h.Command[0] == "" {
+		return errors.New("no command")
+	}
+
+	return nil
+}
+
+func (n *execNotifier) id() string {
+	return "exec:" + n.hook.Name
+}
+
+func (n *execNotifier) wants(kind NotificationKind) bool {
+	if len(n.hook.Kinds) == 0 {
+		return true
+	}
+
+	for _, k := range n.hook.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *execNotifier) notify(ctx context.Context, data messageData) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.hook.Timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, n.hook.Command[0], n.hook.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"PRUFEN_KIND="+string(data.Kind),
+		"PRUFEN_URL="+data.URL,
+		"PRUFEN_SLOTS_AVAILABLE="+strconv.FormatBool(data.SlotsAvailable),
+		"PRUFEN_STARTED_AT="+data.StartedAt.Format(time.RFC3339),
+		"PRUFEN_ERROR="+data.Error,
+	)
+
+	start := time.Now()
+	err = cmd.Run()
+
+	l := n.logger.With("hook", n.hook.Name, "kind", data.Kind, "elapsed sec", time.Since(start).Seconds())
+	if out := strings.TrimSpace(stderr.String()); out != "" {
+		l.Warn("exec hook stderr", "stderr", out)
+	}
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		// the command can't be started, retries would not help
+		return permanentError{fmt.Errorf("exec hook %q failed: %w", n.hook.Name, err)}
+	}
+	if err != nil {
+		return fmt.Errorf("exec hook %q failed: %w", n.hook.Name, err)
+	}
+	l.Debug("exec hook finished")
+
+	return nil
+}
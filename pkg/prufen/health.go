@@ -0,0 +1,268 @@
+package prufen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// healthCacheTTL is the time results of the expensive readiness checks,
+	// such as launching Chrome, are reused for.
+	healthCacheTTL = time.Minute
+	// chromeCheckTimeout limits launching Chrome by the readiness check.
+	chromeCheckTimeout = time.Second * 30
+	// stuckRunFactor is the number of scenario timeouts a run is considered
+	// stuck after, runs are bounded by the timeout except launching Chrome.
+	stuckRunFactor = 2
+)
+
+type (
+	// healthCheck is the result of a single check of /healthz or /readyz.
+	healthCheck struct {
+		OK        bool      `json:"ok"`
+		Details   string    `json:"details,omitempty"`
+		CheckedAt time.Time `json:"checked_at"`
+	}
+
+	// healthReport is the response of /healthz and /readyz.
+	healthReport struct {
+		Status string                 `json:"status"`
+		Checks map[string]healthCheck `json:"checks"`
+	}
+
+	// healthCache keeps results of the expensive checks. Stale results are
+	// returned while the check is refreshed in background, so probes neither
+	// wait for launching Chrome nor launch it twice.
+	healthCache struct {
+		mu     sync.Mutex
+		checks map[string]healthCheck
+		// refreshing holds the checks in progress, closed once they're done.
+		refreshing map[string]chan struct{}
+	}
+)
+
+// cached returns the last result of the check and refreshes it if it's stale,
+// only the first call waits for the check.
+func (c *healthCache) cached(name string, check func() healthCheck) healthCheck {
+	c.mu.Lock()
+	res, ok := c.checks[name]
+	if ok && time.Since(res.CheckedAt) < healthCacheTTL {
+		c.mu.Unlock()
+		return res
+	}
+
+	done, refreshing := c.refreshing[name]
+	if !refreshing {
+		done = make(chan struct{})
+		if c.refreshing == nil {
+			c.refreshing = map[string]chan struct{}{}
+		}
+		c.refreshing[name] = done
+		go c.refresh(name, check, done)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		return res
+	}
+
+	<-done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.checks[name]
+}
+
+func (c *healthCache) refresh(name string, check func() healthCheck, done chan struct{}) {
+	res := check()
+
+	c.mu.Lock()
+	if c.checks == nil {
+		c.checks = map[string]healthCheck{}
+	}
+	c.checks[name] = res
+	delete(c.refreshing, name)
+	c.mu.Unlock()
+
+	close(done)
+}
+
+// handleHealthz reports whether the process is alive: the poll loops
+// are running and no run is stuck.
+func (r *Runner) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeHealthReport(w, map[string]healthCheck{
+		"poll_loops": r.checkPollLoops(),
+		"runs":       r.checkStuckRuns(),
+	})
+}
+
+// handleReadyz reports whether the runner is able to check slots and to notify
+// about them, and whether the last run has finished within the window.
+func (r *Runner) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	writeHealthReport(w, map[string]healthCheck{
+		"chrome":    r.health.cached("chrome", r.checkChrome),
+		"notifiers": r.health.cached("notifiers", r.checkNotifiers),
+		"last_run":  r.checkLastRun(),
+	})
+}
+
+func writeHealthReport(w http.ResponseWriter, checks map[string]healthCheck) {
+	report := healthReport{Status: "ok", Checks: checks}
+	code := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			report.Status, code = "failing", http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, code, report)
+}
+
+func (r *Runner) checkPollLoops() healthCheck {
+	res := healthCheck{OK: true, CheckedAt: time.Now()}
+	if !r.running.Load() {
+		res.Details = "the runner is not running"
+		return res
+	}
+
+	var stopped []string
+	for _, wt := range r.watches {
+		if !wt.polling.Load() {
+			stopped = append(stopped, wt.name)
+		}
+	}
+	if len(stopped) > 0 {
+		res.OK = false
+		res.Details = "poll loops are not running: " + strings.Join(stopped, ", ")
+	}
+
+	return res
+}
+
+func (r *Runner) checkStuckRuns() healthCheck {
+	res := healthCheck{OK: true, CheckedAt: time.Now()}
+
+	oldest := r.limiter.oldestRun()
+	if oldest.IsZero() {
+		res.Details = "no runs in progress"
+		return res
+	}
+
+	age := res.CheckedAt.Sub(oldest).Round(time.Second)
+	res.Details = fmt.Sprintf("the oldest run is in progress for %s", age)
+	if age > r.runTimeout*stuckRunFactor {
+		res.OK = false
+	}
+
+	return res
+}
+
+// checkChrome launches Chrome with the configured options and closes it,
+// unless a run has just succeeded. The launch takes a worker, so it does
+// not exceed the configured number of browsers.
+func (r *Runner) checkChrome() healthCheck {
+	res := healthCheck{CheckedAt: time.Now()}
+
+	if runs := r.history(r.watches, 1); len(runs) > 0 && runs[0].Error == "" {
+		if finished := runs[0].StartedAt.Add(runs[0].Duration); res.CheckedAt.Sub(finished) < healthCacheTTL {
+			res.OK = true
+			res.Details = "a run has succeeded at " + finished.Format(time.DateTime)
+			return res
+		}
+	}
+
+	free, err := r.limiter.acquireWorker(r.baseCtx)
+	if err != nil {
+		res.Details = fmt.Sprintf("failed to wait for a worker: %v", err)
+		return res
+	}
+	defer free()
+
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(r.baseCtx, chromeCheckTimeout)
+	defer cancel()
+
+	ctx, cancel = chromedp.NewExecAllocator(ctx, r.opts...)
+	defer cancel() // allocator
+
+	ctx, cancel = chromedp.NewContext(ctx)
+	defer cancel() // new tab
+
+	if err := chromedp.Run(ctx); err != nil {
+		res.Details = fmt.Sprintf("failed to launch: %v", err)
+		return res
+	}
+
+	res.OK = true
+	res.Details = fmt.Sprintf("launched in %s", time.Since(started).Round(time.Millisecond))
+
+	return res
+}
+
+// checkNotifiers validates the telegram bot token and
+// the commands of the exec hooks.
+func (r *Runner) checkNotifiers() healthCheck {
+	res := healthCheck{OK: true, CheckedAt: time.Now()}
+
+	var details []string
+	if r.botClient != nil {
+		if me, err := r.botClient.GetMe(); err != nil {
+			res.OK = false
+			details = append(details, fmt.Sprintf("telegram: %v", err))
+		} else {
+			details = append(details, "telegram: @"+me.UserName)
+		}
+	}
+
+	for _, n := range r.notifiers {
+		en, ok := n.(*execNotifier)
+		if !ok {
+			continue
+		}
+		if _, err := exec.LookPath(en.hook.Command[0]); err != nil {
+			res.OK = false
+			details = append(details, fmt.Sprintf("%s: %v", en.id(), err))
+		} else {
+			details = append(details, en.id()+": ok")
+		}
+	}
+	res.Details = strings.Join(details, "; ")
+
+	return res
+}
+
+// checkLastRun reports whether runs keep up with the schedule, that is
+// a successful run of each watch has finished within the window and its
+// interval. Polling paused or off by the schedule, e.g. at night, is not
+// a failure, the time is measured since it's back on.
+func (r *Runner) checkLastRun() healthCheck {
+	res := healthCheck{OK: true, CheckedAt: time.Now()}
+
+	if runs := r.history(r.watches, 1); len(runs) > 0 {
+		res.Details = "the last run has finished at " + runs[0].StartedAt.Add(runs[0].Duration).Format(time.DateTime)
+	} else {
+		res.Details = "no runs yet since the start at " + r.startedAt.Format(time.DateTime)
+	}
+
+	var late []string
+	for _, wt := range r.watches {
+		deadline := wt.sched.runDeadline(res.CheckedAt, r.startedAt, r.readinessRunWindow)
+		if !deadline.IsZero() && res.CheckedAt.After(deadline) {
+			late = append(late, fmt.Sprintf("%s is overdue since %s", wt.name, deadline.Format(time.DateTime)))
+		}
+	}
+	if len(late) > 0 {
+		res.OK = false
+		res.Details += ", no successful runs have finished in time: " + strings.Join(late, ", ")
+	}
+
+	return res
+}
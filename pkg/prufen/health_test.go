@@ -0,0 +1,182 @@
+package prufen
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckLastRun(t *testing.T) {
+	now := time.Now()
+	berlin, err := time.LoadLocation(DefaultScheduleLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeOfDay := func(t time.Time) time.Duration {
+		t = t.In(berlin)
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	pausedWindow := func(from, to time.Time) *Schedule {
+		s := &Schedule{Windows: []ScheduleWindow{{Paused: true, From: timeOfDay(from), To: timeOfDay(to)}}}
+		if err := s.compile(OfficeHours{}); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		schedule  *Schedule
+		paused    bool
+		resumedAt time.Time
+		startedAt time.Time
+		runs      []Result
+		ok        bool
+	}{
+		{
+			name:      "no runs yet since a recent start",
+			startedAt: now.Add(-time.Minute * 5),
+			ok:        true,
+		},
+		{
+			name: "no runs since the start",
+		},
+		{
+			name: "on time",
+			runs: []Result{{StartedAt: now.Add(-time.Minute)}},
+			ok:   true,
+		},
+		{
+			name: "late within the window",
+			runs: []Result{{StartedAt: now.Add(-time.Minute * 50)}},
+			ok:   true,
+		},
+		{
+			name: "late",
+			runs: []Result{{StartedAt: now.Add(-time.Hour * 2)}},
+		},
+		{
+			name: "every run fails",
+			runs: []Result{
+				{StartedAt: now.Add(-time.Hour * 2)},
+				{StartedAt: now.Add(-time.Minute * 3), Error: "failed"},
+				{StartedAt: now.Add(-time.Minute), Error: "failed"},
+			},
+		},
+		{
+			name:   "paused",
+			paused: true,
+			runs:   []Result{{StartedAt: now.Add(-time.Hour * 5)}},
+			ok:     true,
+		},
+		{
+			name:      "resumed",
+			resumedAt: now.Add(-time.Minute * 10),
+			runs:      []Result{{StartedAt: now.Add(-time.Hour * 5)}},
+			ok:        true,
+		},
+		{
+			name:     "paused by the schedule",
+			schedule: pausedWindow(now.Add(-time.Hour*5+time.Minute), now.Add(time.Hour*3)),
+			runs:     []Result{{StartedAt: now.Add(-time.Hour * 5)}},
+			ok:       true,
+		},
+		{
+			name:     "resumed by the schedule",
+			schedule: pausedWindow(now.Add(-time.Hour*5+time.Minute), now.Add(-time.Minute*10)),
+			runs:     []Result{{StartedAt: now.Add(-time.Hour * 5)}},
+			ok:       true,
+		},
+		{
+			name:     "late after resumed by the schedule",
+			schedule: pausedWindow(now.Add(-time.Hour*5+time.Minute), now.Add(-time.Hour*2)),
+			runs:     []Result{{StartedAt: now.Add(-time.Hour * 5)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScheduler("test", time.Minute*3, tt.schedule, nil, 0, ErrorBackoff{})
+			s.paused, s.resumedAt = tt.paused, tt.resumedAt
+			for _, res := range tt.runs {
+				res.Duration = time.Second * 20
+				s.runs = append(s.runs, res)
+				s.lastStart = res.StartedAt
+			}
+
+			r := &Runner{
+				watches:            []*watch{{name: "test", sched: s}},
+				readinessRunWindow: time.Hour,
+				startedAt:          tt.startedAt,
+			}
+			if r.startedAt.IsZero() {
+				r.startedAt = now.Add(-time.Hour * 6)
+			}
+
+			if res := r.checkLastRun(); res.OK != tt.ok {
+				t.Errorf("checkLastRun() = %v (%s), want %v", res.OK, res.Details, tt.ok)
+			}
+		})
+	}
+}
+
+func TestHealthCache(t *testing.T) {
+	var (
+		c       healthCache
+		calls   atomic.Int32
+		release = make(chan struct{})
+	)
+	check := func() healthCheck {
+		calls.Add(1)
+		<-release
+		return healthCheck{OK: true, CheckedAt: time.Now()}
+	}
+
+	// concurrent probes wait for the same first check
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res := c.cached("chrome", check); !res.OK {
+				t.Error("the first check is not returned")
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("the check has run %d times, want once", n)
+	}
+
+	// the stale result is returned right away while it's refreshed
+	stale := healthCheck{OK: true, Details: "stale", CheckedAt: time.Now().Add(-healthCacheTTL * 2)}
+	c.mu.Lock()
+	c.checks["chrome"] = stale
+	c.mu.Unlock()
+
+	refreshed := make(chan struct{})
+	slow := func() healthCheck {
+		<-refreshed
+		return healthCheck{Details: "fresh", CheckedAt: time.Now()}
+	}
+	for i := 0; i < 2; i++ {
+		if res := c.cached("chrome", slow); res.Details != "stale" {
+			t.Fatalf("cached() = %q, want the stale result", res.Details)
+		}
+	}
+	close(refreshed)
+
+	for deadline := time.Now().Add(time.Second); ; {
+		if res := c.cached("chrome", slow); res.Details == "fresh" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the stale result is not refreshed")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
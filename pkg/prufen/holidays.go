@@ -0,0 +1,170 @@
+package prufen
+
+import (
+	"fmt"
+	"time"
+)
+
+// berlinLocation is the location of the Berlin public holidays and office hours,
+// schedules could be evaluated in another one.
+var berlinLocation = func() *time.Location {
+	loc, err := time.LoadLocation(DefaultScheduleLocation)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}()
+
+// businessDayLookahead is the farthest the next business day is looked up for.
+const businessDayLookahead = 30
+
+type (
+	// OfficeHours are the hours the ABH works on business days, that is
+	// on its weekdays except the Berlin public holidays.
+	OfficeHours struct {
+		// Weekdays the office works on, defaults to Monday to Friday.
+		Weekdays []time.Weekday
+		// From and To are times of day since midnight in Berlin,
+		// default to the DefaultOfficeHoursFrom and DefaultOfficeHoursTo.
+		From, To time.Duration
+	}
+
+	// civilDate is a calendar date regardless of the location.
+	civilDate struct {
+		year  int
+		month time.Month
+		day   int
+	}
+)
+
+const (
+	DefaultOfficeHoursFrom = time.Hour * 7
+	DefaultOfficeHoursTo   = time.Hour * 18
+)
+
+// berlinOneOffHolidays are proclaimed for a single year only.
+var berlinOneOffHolidays = map[civilDate]string{
+	{2020, time.May, 8}: "Tag der Befreiung",
+	{2025, time.May, 8}: "Tag der Befreiung",
+}
+
+func (h *OfficeHours) setDefaults() {
+	if len(h.Weekdays) == 0 {
+		h.Weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	}
+	if h.From == 0 && h.To == 0 {
+		h.From, h.To = DefaultOfficeHoursFrom, DefaultOfficeHoursTo
+	}
+}
+
+func (h OfficeHours) validate() error {
+	if h.From < 0 || h.To > time.Hour*24 || h.From >= h.To {
+		return fmt.Errorf("office hours should be within a day, from before to")
+	}
+
+	return nil
+}
+
+// businessDay reports whether the office works on the day of the time.
+func (h OfficeHours) businessDay(t time.Time) bool {
+	t = t.In(berlinLocation)
+	if _, ok := berlinHoliday(t); ok {
+		return false
+	}
+
+	for _, wd := range h.Weekdays {
+		if wd == t.Weekday() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// open reports whether the office is open at the time.
+func (h OfficeHours) open(t time.Time) bool {
+	t = t.In(berlinLocation)
+	if !h.businessDay(t) {
+		return false
+	}
+
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	return tod >= h.From && tod < h.To
+}
+
+// nextOpening returns the time the office opens at after the given one,
+// the zero time if there is no business day within the lookahead.
+func (h OfficeHours) nextOpening(t time.Time) time.Time {
+	t = t.In(berlinLocation)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, berlinLocation)
+
+	for i := 0; i <= businessDayLookahead; i++ {
+		d := day.AddDate(0, 0, i)
+		opening := d.Add(h.From)
+		if h.businessDay(d) && opening.After(t) {
+			return opening
+		}
+	}
+
+	return time.Time{}
+}
+
+// berlinHoliday returns the name of the Berlin public holiday
+// on the day of the time in Berlin, if it's one.
+func berlinHoliday(t time.Time) (string, bool) {
+	t = t.In(berlinLocation)
+	date := civilDate{t.Year(), t.Month(), t.Day()}
+
+	if name, ok := berlinOneOffHolidays[date]; ok {
+		return name, true
+	}
+
+	switch {
+	case date.month == time.January && date.day == 1:
+		return "Neujahr", true
+	case date.month == time.March && date.day == 8 && date.year >= 2019:
+		return "Internationaler Frauentag", true
+	case date.month == time.May && date.day == 1:
+		return "Tag der Arbeit", true
+	case date.month == time.October && date.day == 3:
+		return "Tag der Deutschen Einheit", true
+	case date.month == time.December && date.day == 25:
+		return "1. Weihnachtstag", true
+	case date.month == time.December && date.day == 26:
+		return "2. Weihnachtstag", true
+	}
+
+	// movable feasts
+	easter := easterSunday(date.year)
+	day := time.Date(date.year, date.month, date.day, 0, 0, 0, 0, time.UTC)
+	switch int(day.Sub(easter).Hours() / 24) {
+	case -2:
+		return "Karfreitag", true
+	case 1:
+		return "Ostermontag", true
+	case 39:
+		return "Christi Himmelfahrt", true
+	case 50:
+		return "Pfingstmontag", true
+	}
+
+	return "", false
+}
+
+// easterSunday returns the date of the Easter Sunday in the Gregorian
+// calendar by the anonymous algorithm, in UTC.
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
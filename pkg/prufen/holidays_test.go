@@ -0,0 +1,144 @@
+package prufen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEasterSunday(t *testing.T) {
+	for year, want := range map[int]civilDate{
+		2000: {2000, time.April, 23},
+		2008: {2008, time.March, 23},
+		2019: {2019, time.April, 21},
+		2020: {2020, time.April, 12},
+		2021: {2021, time.April, 4},
+		2022: {2022, time.April, 17},
+		2023: {2023, time.April, 9},
+		2024: {2024, time.March, 31},
+		2025: {2025, time.April, 20},
+		2026: {2026, time.April, 5},
+		2038: {2038, time.April, 25},
+	} {
+		got := easterSunday(year)
+		if d := (civilDate{got.Year(), got.Month(), got.Day()}); d != want {
+			t.Errorf("easterSunday(%d) = %v, want %v", year, d, want)
+		}
+	}
+}
+
+func TestBerlinHoliday(t *testing.T) {
+	tests := []struct {
+		date civilDate
+		want string
+	}{
+		{civilDate{2023, time.January, 1}, "Neujahr"},
+		{civilDate{2018, time.March, 8}, ""},
+		{civilDate{2019, time.March, 8}, "Internationaler Frauentag"},
+		{civilDate{2024, time.March, 8}, "Internationaler Frauentag"},
+		{civilDate{2024, time.March, 29}, "Karfreitag"},
+		{civilDate{2024, time.March, 31}, ""},
+		{civilDate{2024, time.April, 1}, "Ostermontag"},
+		{civilDate{2025, time.April, 18}, "Karfreitag"},
+		{civilDate{2025, time.April, 21}, "Ostermontag"},
+		{civilDate{2025, time.May, 1}, "Tag der Arbeit"},
+		{civilDate{2025, time.May, 29}, "Christi Himmelfahrt"},
+		{civilDate{2025, time.June, 9}, "Pfingstmontag"},
+		{civilDate{2019, time.May, 8}, ""},
+		{civilDate{2020, time.May, 8}, "Tag der Befreiung"},
+		{civilDate{2021, time.May, 8}, ""},
+		{civilDate{2025, time.May, 8}, "Tag der Befreiung"},
+		{civilDate{2026, time.May, 8}, ""},
+		{civilDate{2023, time.October, 3}, "Tag der Deutschen Einheit"},
+		{civilDate{2023, time.December, 24}, ""},
+		{civilDate{2023, time.December, 25}, "1. Weihnachtstag"},
+		{civilDate{2023, time.December, 26}, "2. Weihnachtstag"},
+		{civilDate{2023, time.December, 31}, ""},
+	}
+
+	for _, tt := range tests {
+		// the day is taken in Berlin regardless of the location of the time
+		for _, at := range []time.Time{
+			time.Date(tt.date.year, tt.date.month, tt.date.day, 0, 0, 0, 0, berlinLocation),
+			time.Date(tt.date.year, tt.date.month, tt.date.day, 23, 59, 0, 0, berlinLocation).UTC(),
+		} {
+			got, ok := berlinHoliday(at)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("berlinHoliday(%s) = %q, %v, want %q", at, got, ok, tt.want)
+			}
+		}
+	}
+}
+
+func TestOfficeHoursNextOpening(t *testing.T) {
+	var h OfficeHours
+	h.setDefaults()
+
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, berlinLocation)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+		open bool
+	}{
+		{
+			name: "before the opening",
+			now:  at(2023, time.March, 6, 6, 30),
+			want: at(2023, time.March, 6, 7, 0),
+		},
+		{
+			name: "open",
+			now:  at(2023, time.March, 6, 7, 0),
+			want: at(2023, time.March, 7, 7, 0),
+			open: true,
+		},
+		{
+			name: "after the closing",
+			now:  at(2023, time.March, 6, 18, 0),
+			want: at(2023, time.March, 7, 7, 0),
+		},
+		{
+			name: "over Frauentag",
+			now:  at(2023, time.March, 7, 19, 0),
+			want: at(2023, time.March, 9, 7, 0),
+		},
+		{
+			name: "over the weekend",
+			now:  at(2023, time.March, 10, 18, 30),
+			want: at(2023, time.March, 13, 7, 0),
+		},
+		{
+			name: "on the weekend",
+			now:  at(2023, time.March, 12, 12, 0),
+			want: at(2023, time.March, 13, 7, 0),
+		},
+		{
+			name: "over Easter",
+			now:  at(2024, time.March, 28, 19, 0),
+			want: at(2024, time.April, 2, 7, 0),
+		},
+		{
+			name: "on Easter Monday",
+			now:  at(2025, time.April, 21, 10, 0),
+			want: at(2025, time.April, 22, 7, 0),
+		},
+		{
+			name: "over Christmas",
+			now:  at(2025, time.December, 24, 18, 0),
+			want: at(2025, time.December, 29, 7, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.nextOpening(tt.now); !got.Equal(tt.want) {
+				t.Errorf("nextOpening() = %s, want %s", got, tt.want)
+			}
+			if got := h.open(tt.now); got != tt.open {
+				t.Errorf("open() = %v, want %v", got, tt.open)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package prufen
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// runLimiter bounds the number of concurrent runs with a worker pool,
+// and the number of runs started within a minute across all profiles.
+type runLimiter struct {
+	workers chan struct{}
+	// now is the clock of the limits.
+	now func() time.Time
+
+	mu        sync.Mutex
+	perMinute int
+	// starts are the start times of runs within the last minute.
+	starts []time.Time
+	// running holds the start times of runs in progress.
+	running map[uint64]time.Time
+	seq     uint64
+}
+
+func newRunLimiter(workers, perMinute int) *runLimiter {
+	return &runLimiter{
+		workers:   make(chan struct{}, workers),
+		now:       time.Now,
+		perMinute: perMinute,
+		running:   map[uint64]time.Time{},
+	}
+}
+
+// acquire waits for a free worker and the rate limit, it returns
+// the function to free the worker once the run is finished.
+func (l *runLimiter) acquire(ctx context.Context) (func(), error) {
+	release, err := l.acquireWorker(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		wait := l.reserve(l.now())
+		if wait <= 0 {
+			return l.track(release), nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// acquireWorker waits for a free worker only, e.g. to launch Chrome
+// without a run against the site.
+func (l *runLimiter) acquireWorker(ctx context.Context) (func(), error) {
+	select {
+	case l.workers <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return func() { <-l.workers }, nil
+}
+
+// reserve registers the run start if it's within the limit,
+// otherwise it returns the duration to wait for.
+func (l *runLimiter) reserve(now time.Time) time.Duration {
+	if l.perMinute <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i := 0
+	for i < len(l.starts) && now.Sub(l.starts[i]) >= time.Minute {
+		i++
+	}
+	l.starts = l.starts[i:]
+
+	if len(l.starts) < l.perMinute {
+		l.starts = append(l.starts, now)
+		return 0
+	}
+
+	return l.starts[0].Add(time.Minute).Sub(now)
+}
+
+// track registers the run in progress until the returned function is called.
+func (l *runLimiter) track(release func()) func() {
+	l.mu.Lock()
+	l.seq++
+	id := l.seq
+	l.running[id] = l.now()
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		delete(l.running, id)
+		l.mu.Unlock()
+
+		release()
+	}
+}
+
+// oldestRun returns the start time of the oldest run in progress,
+// the zero time if there are none.
+func (l *runLimiter) oldestRun() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var oldest time.Time
+	for _, at := range l.running {
+		if oldest.IsZero() || at.Before(oldest) {
+			oldest = at
+		}
+	}
+
+	return oldest
+}
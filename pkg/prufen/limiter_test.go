@@ -0,0 +1,161 @@
+package prufen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunLimiterReserve(t *testing.T) {
+	start := time.Date(2023, time.March, 6, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		perMinute int
+		at        []time.Duration
+		want      []time.Duration
+	}{
+		{
+			name: "unlimited",
+			at:   []time.Duration{0, 0, 0, 0},
+			want: []time.Duration{0, 0, 0, 0},
+		},
+		{
+			name:      "within the budget",
+			perMinute: 2,
+			at:        []time.Duration{0, time.Second * 10},
+			want:      []time.Duration{0, 0},
+		},
+		{
+			name:      "over the budget",
+			perMinute: 2,
+			at:        []time.Duration{0, time.Second * 10, time.Second * 20, time.Second * 59},
+			want:      []time.Duration{0, 0, time.Second * 40, time.Second},
+		},
+		{
+			name:      "the oldest start has expired",
+			perMinute: 2,
+			at:        []time.Duration{0, time.Second * 10, time.Minute, time.Minute + time.Second},
+			want:      []time.Duration{0, 0, 0, time.Second * 9},
+		},
+		{
+			name:      "waiting does not take the budget",
+			perMinute: 1,
+			at:        []time.Duration{0, time.Second * 30, time.Second * 45, time.Minute},
+			want:      []time.Duration{0, time.Second * 30, time.Second * 15, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRunLimiter(1, tt.perMinute)
+			for i, at := range tt.at {
+				if got := l.reserve(start.Add(at)); got != tt.want[i] {
+					t.Errorf("reserve() at %s = %s, want %s", at, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunLimiterWorkers(t *testing.T) {
+	now := time.Date(2023, time.March, 6, 9, 0, 0, 0, time.UTC)
+	l := newRunLimiter(2, 0)
+	l.now = func() time.Time { return now }
+
+	free1, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	free2, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if _, err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire() over the workers = %v, want the deadline exceeded", err)
+	}
+
+	if got, want := l.oldestRun(), now.Add(-time.Minute); !got.Equal(want) {
+		t.Errorf("oldestRun() = %s, want %s", got, want)
+	}
+
+	free1()
+	if got := l.oldestRun(); !got.Equal(now) {
+		t.Errorf("oldestRun() = %s after the oldest run, want %s", got, now)
+	}
+
+	free3, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free2()
+	free3()
+
+	if got := l.oldestRun(); !got.IsZero() {
+		t.Errorf("oldestRun() = %s without runs, want the zero time", got)
+	}
+}
+
+func TestRunLimiterCancelledWait(t *testing.T) {
+	l := newRunLimiter(1, 1)
+
+	free, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+
+	// the worker is free, but the budget of the minute is spent
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.acquire(ctx)
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("acquire() = %v, want it cancelled", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("the cancelled acquire() keeps waiting")
+	}
+
+	// the worker taken while waiting is freed
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	freeWorker, err := l.acquireWorker(ctx)
+	if err != nil {
+		t.Fatalf("the worker has leaked: %v", err)
+	}
+	freeWorker()
+
+	if got := l.oldestRun(); !got.IsZero() {
+		t.Errorf("the cancelled run is tracked since %s", got)
+	}
+}
+
+func TestRunLimiterWaitsForBudget(t *testing.T) {
+	l := newRunLimiter(1, 1)
+	// the only start of the minute expires shortly
+	l.starts = []time.Time{time.Now().Add(-time.Minute + time.Millisecond*30)}
+
+	started := time.Now()
+	free, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	free()
+
+	if waited := time.Since(started); waited < time.Millisecond*20 {
+		t.Errorf("acquire() has waited for %s only", waited)
+	}
+}
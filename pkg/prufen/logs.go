@@ -0,0 +1,99 @@
+package prufen
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// recentLogsSize is the number of recent warnings and errors kept in memory.
+const recentLogsSize = 100
+
+type (
+	// recentLogs keeps the last warnings and errors to show them with the bot.
+	recentLogs struct {
+		mu      sync.Mutex
+		entries []string
+		next    int
+	}
+
+	// recentLogsHandler passes records to the next handler and
+	// keeps warnings and errors in the recent logs.
+	recentLogsHandler struct {
+		next slog.Handler
+		logs *recentLogs
+		// attrs are formatted attributes added with WithAttrs.
+		attrs string
+		group string
+	}
+)
+
+func newRecentLogs() *recentLogs {
+	return &recentLogs{entries: make([]string, 0, recentLogsSize)}
+}
+
+func (l *recentLogs) add(entry string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.entries) < recentLogsSize {
+		l.entries = append(l.entries, entry)
+		return
+	}
+
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % recentLogsSize
+}
+
+// tail returns up to n last entries, the oldest first.
+func (l *recentLogs) tail(n int) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ordered := append(append([]string(nil), l.entries[l.next:]...), l.entries[:l.next]...)
+	if n < len(ordered) {
+		ordered = ordered[len(ordered)-n:]
+	}
+
+	return ordered
+}
+
+func (h *recentLogsHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+func (h *recentLogsHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if rec.Level >= slog.LevelWarn {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%s %s %s%s", rec.Time.Format(time.DateTime), rec.Level, rec.Message, h.attrs)
+		rec.Attrs(func(a slog.Attr) bool {
+			fmt.Fprintf(&sb, " %s%s=%v", h.group, a.Key, a.Value)
+			return true
+		})
+		h.logs.add(sb.String())
+	}
+
+	if !h.next.Enabled(ctx, rec.Level) {
+		return nil
+	}
+
+	return h.next.Handle(ctx, rec)
+}
+
+func (h *recentLogsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var sb strings.Builder
+	sb.WriteString(h.attrs)
+	for _, a := range attrs {
+		fmt.Fprintf(&sb, " %s%s=%v", h.group, a.Key, a.Value)
+	}
+
+	return &recentLogsHandler{next: h.next.WithAttrs(attrs), logs: h.logs, attrs: sb.String(), group: h.group}
+}
+
+func (h *recentLogsHandler) WithGroup(name string) slog.Handler {
+	return &recentLogsHandler{next: h.next.WithGroup(name), logs: h.logs, attrs: h.attrs, group: h.group + name + "."}
+}
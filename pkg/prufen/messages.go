@@ -0,0 +1,238 @@
+package prufen
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// defaultTemplates holds default message templates per each supported parse mode.
+// Every action's output is escaped according to the parse mode,
+// so the templates must not escape values on their own.
+var defaultTemplates = map[string]map[NotificationKind]string{
+	"": {
+		KindSlots:   "Slots are available!\nProceed further: {{ .URL }}",
+		KindNoSlots: "No slots are available\nProceed further: {{ .URL }}{{ if .OfficeClosed }}\nThe office is closed{{ if .Holiday }} for {{ .Holiday }}{{ end }}, next business day is {{ day .NextBusinessDay }}{{ end }}",
+		KindError:   "Failed to check slots at {{ datetime .StartedAt }}: {{ .Error }}",
+
+		KindSlotsGone:     "Slots are gone, they were available since {{ datetime .AvailableSince }}{{ if .OfficeClosed }}\nThe office is closed{{ if .Holiday }} for {{ .Holiday }}{{ end }}, next business day is {{ day .NextBusinessDay }}{{ end }}",
+		KindSlotsReminder: "Slots are still available since {{ datetime .AvailableSince }}!\nProceed further: {{ .URL }}",
+		KindEscalation:    "{{ repeat \"❗\" .Urgency }} Slots are available since {{ datetime .AvailableSince }} and nobody has acknowledged them!\nProceed further: {{ .URL }}",
+
+		KindBreakerOpen:   "The ABH site keeps failing, {{ .Failures }} polls in a row have failed, only probes are run now.\nLast error: {{ .Error }}",
+		KindBreakerClosed: "The ABH site is back after {{ .Failures }} failed polls, polling as usual",
+
+		KindStopped: "Polling has stopped after {{ .Runs }} runs: {{ if eq .StopReason \"found\" }}slots are available!\nProceed further: {{ .URL }}{{ else if eq .StopReason \"deadline\" }}the deadline has passed{{ else }}the max number of runs is reached{{ end }}",
+
+		KindSubscriptionFailing: "Checks of your subscription keep failing, {{ .Failures }} in a row: {{ .Error }}\nMake sure the citizenship is named as on the ABH site, use /subscribe to change it",
+	},
+	tgbotapi.ModeHTML: {
+		KindSlots:   "<b>Slots are available!</b>\nCitizenship: {{ .Profile.Citizenship }}, people: {{ .Profile.PeopleNumber }}\nChecked at {{ datetime .StartedAt }} in {{ seconds .Duration }}s\nProceed further: {{ .URL }}",
+		KindNoSlots: "No slots are available\nChecked at {{ datetime .StartedAt }} in {{ seconds .Duration }}s\nProceed further: {{ .URL }}{{ if .OfficeClosed }}\nThe office is closed{{ if .Holiday }} for {{ .Holiday }}{{ end }}, next business day is {{ day .NextBusinessDay }}{{ end }}",
+		KindError:   "<b>Failed to check slots</b> at {{ datetime .StartedAt }}\n<code>{{ .Error }}</code>",
+
+		KindSlotsGone:     "Slots are gone, they were available since {{ datetime .AvailableSince }}{{ if .OfficeClosed }}\nThe office is closed{{ if .Holiday }} for {{ .Holiday }}{{ end }}, next business day is {{ day .NextBusinessDay }}{{ end }}",
+		KindSlotsReminder: "<b>Slots are still available</b> since {{ datetime .AvailableSince }}\nProceed further: {{ .URL }}",
+		KindEscalation:    "{{ repeat \"❗\" .Urgency }} <b>Slots are available</b> since {{ datetime .AvailableSince }} and nobody has acknowledged them!\nProceed further: {{ .URL }}",
+
+		KindBreakerOpen:   "<b>The ABH site keeps failing</b>, {{ .Failures }} polls in a row have failed, only probes are run now\nLast error: <code>{{ .Error }}</code>",
+		KindBreakerClosed: "<b>The ABH site is back</b> after {{ .Failures }} failed polls, polling as usual",
+
+		KindStopped: "<b>Polling has stopped</b> after {{ .Runs }} runs: {{ if eq .StopReason \"found\" }}slots are available!\nProceed further: {{ .URL }}{{ else if eq .StopReason \"deadline\" }}the deadline has passed{{ else }}the max number of runs is reached{{ end }}",
+
+		KindSubscriptionFailing: "<b>Checks of your subscription keep failing</b>, {{ .Failures }} in a row\n<code>{{ .Error }}</code>\nMake sure the citizenship is named as on the ABH site, use /subscribe to change it",
+	},
+	tgbotapi.ModeMarkdownV2: {
+		KindSlots:   "*Slots are available\\!*\nCitizenship: {{ .Profile.Citizenship }}, people: {{ .Profile.PeopleNumber }}\nChecked at {{ datetime .StartedAt }} in {{ seconds .Duration }}s\nProceed further: {{ .URL }}",
+		KindNoSlots: "No slots are available\nChecked at {{ datetime .StartedAt }} in {{ seconds .Duration }}s\nProceed further: {{ .URL }}{{ if .OfficeClosed }}\nThe office is closed{{ if .Holiday }} for {{ .Holiday }}{{ end }}, next business day is {{ day .NextBusinessDay }}{{ end }}",
+		KindError:   "*Failed to check slots* at {{ datetime .StartedAt }}\n`{{ .Error }}`",
+
+		KindSlotsGone:     "Slots are gone, they were available since {{ datetime .AvailableSince }}{{ if .OfficeClosed }}\nThe office is closed{{ if .Holiday }} for {{ .Holiday }}{{ end }}, next business day is {{ day .NextBusinessDay }}{{ end }}",
+		KindSlotsReminder: "*Slots are still available* since {{ datetime .AvailableSince }}\nProceed further: {{ .URL }}",
+		KindEscalation:    "{{ repeat \"❗\" .Urgency }} *Slots are available* since {{ datetime .AvailableSince }} and nobody has acknowledged them\\!\nProceed further: {{ .URL }}",
+
+		KindBreakerOpen:   "*The ABH site keeps failing*, {{ .Failures }} polls in a row have failed, only probes are run now\nLast error: `{{ .Error }}`",
+		KindBreakerClosed: "*The ABH site is back* after {{ .Failures }} failed polls, polling as usual",
+
+		KindStopped: "*Polling has stopped* after {{ .Runs }} runs: {{ if eq .StopReason \"found\" }}slots are available\\!\nProceed further: {{ .URL }}{{ else if eq .StopReason \"deadline\" }}the deadline has passed{{ else }}the max number of runs is reached{{ end }}",
+
+		KindSubscriptionFailing: "*Checks of your subscription keep failing*, {{ .Failures }} in a row\n`{{ .Error }}`\nMake sure the citizenship is named as on the ABH site, use /subscribe to change it",
+	},
+}
+
+func init() {
+	// legacy markdown has nearly nothing to escape in the plain texts
+	defaultTemplates[tgbotapi.ModeMarkdown] = defaultTemplates[""]
+}
+
+type (
+	// messageTemplates renders texts of notifications.
+	messageTemplates struct {
+		parseMode string
+		byKind    map[NotificationKind]*template.Template
+	}
+
+	// messageData is passed to a template on the execution.
+	messageData struct {
+		Result
+		Kind NotificationKind `json:"kind"`
+		// AvailableSince is the time slots have become available at,
+		// set for the slots related kinds.
+		AvailableSince time.Time `json:"available_since,omitempty"`
+		// AlertID is set if the notification could be acknowledged.
+		AlertID string `json:"alert_id,omitempty"`
+		// Urgency grows with each escalation of an alert.
+		Urgency int `json:"urgency,omitempty"`
+		// Failures is the number of consecutive failed polls,
+		// set for the circuit breaker kinds and the KindSubscriptionFailing.
+		Failures int `json:"failures,omitempty"`
+		// StopReason and Runs describe the stop of polling,
+		// set for the KindStopped.
+		StopReason StopReason `json:"stop_reason,omitempty"`
+		Runs       int        `json:"runs,omitempty"`
+		// OfficeClosed is set if the notification is sent out of the office
+		// hours, Holiday is the name of the public holiday of the day,
+		// and NextBusinessDay is the time the office opens at.
+		OfficeClosed    bool      `json:"office_closed,omitempty"`
+		Holiday         string    `json:"holiday,omitempty"`
+		NextBusinessDay time.Time `json:"next_business_day,omitempty"`
+	}
+
+	// rawText is not escaped while rendering.
+	rawText string
+)
+
+func newMessageTemplates(parseMode string, overrides map[NotificationKind]string) (*messageTemplates, error) {
+	defaults, ok := defaultTemplates[parseMode]
+	if !ok {
+		return nil, fmt.Errorf("unsupported telegram parse mode %q", parseMode)
+	}
+
+	m := &messageTemplates{
+		parseMode: parseMode,
+		byKind:    make(map[NotificationKind]*template.Template, len(defaults)),
+	}
+
+	for kind := range overrides {
+		if _, ok := defaults[kind]; !ok {
+			return nil, fmt.Errorf("unknown message template %q", kind)
+		}
+	}
+
+	for kind, text := range defaults {
+		if override, ok := overrides[kind]; ok && override != "" {
+			text = override
+		}
+
+		tmpl, err := template.New(string(kind)).Funcs(m.funcs()).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q message template: %w", kind, err)
+		}
+		for _, t := range tmpl.Templates() {
+			if t.Tree != nil {
+				escapeActions(t.Tree.Root)
+			}
+		}
+
+		m.byKind[kind] = tmpl
+	}
+
+	return m, nil
+}
+
+func (m *messageTemplates) render(data messageData) (string, error) {
+	tmpl, ok := m.byKind[data.Kind]
+	if !ok {
+		return "", fmt.Errorf("no message template for %q", data.Kind)
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render %q message: %w", data.Kind, err)
+	}
+
+	return sb.String(), nil
+}
+
+func (m *messageTemplates) funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"escape": m.escape,
+		"raw": func(v any) rawText {
+			return rawText(fmt.Sprint(v))
+		},
+		"datetime": func(t time.Time) string {
+			return t.Format(time.DateTime)
+		},
+		"day": func(t time.Time) string {
+			return t.Format("Monday, 2 January")
+		},
+		"seconds": func(d time.Duration) string {
+			return fmt.Sprintf("%.1f", d.Seconds())
+		},
+		"repeat": strings.Repeat,
+	}
+	if m.parseMode == tgbotapi.ModeHTML {
+		// values already escaped with the builtin are not escaped twice
+		funcs["html"] = func(args ...any) rawText {
+			return rawText(template.HTMLEscaper(args...))
+		}
+	}
+
+	return funcs
+}
+
+// escape is implicitly appended to each action of a template.
+func (m *messageTemplates) escape(args ...any) string {
+	if len(args) == 1 {
+		if raw, ok := args[0].(rawText); ok {
+			return string(raw)
+		}
+	}
+
+	text := fmt.Sprint(args...)
+	switch m.parseMode {
+	case "":
+		return text
+	case tgbotapi.ModeMarkdownV2:
+		// tgbotapi does not escape the escaping character itself
+		text = strings.ReplaceAll(text, `\`, `\\`)
+	}
+
+	return tgbotapi.EscapeText(m.parseMode, text)
+}
+
+// escapeActions appends the escape function to every printing action,
+// the same way html/template does it for its escapers.
+func escapeActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			escapeActions(c)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier("escape").SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.RangeNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.WithNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	}
+}
@@ -0,0 +1,174 @@
+package prufen
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// hostile has the characters special to any of the parse modes.
+const hostile = "_*[]()~`>#+-=|{}.! <&>"
+
+func hostileData(kind NotificationKind) messageData {
+	now := time.Date(2023, time.March, 6, 9, 0, 0, 0, time.UTC)
+
+	return messageData{
+		Result: Result{
+			Profile:   Profile{Citizenship: hostile, PeopleNumber: "1"},
+			URL:       hostile,
+			StartedAt: now,
+			Duration:  time.Second * 20,
+			Error:     hostile,
+		},
+		Kind:            kind,
+		AvailableSince:  now,
+		Urgency:         2,
+		Failures:        5,
+		StopReason:      StopFound,
+		Runs:            10,
+		OfficeClosed:    true,
+		Holiday:         hostile,
+		NextBusinessDay: now.Add(time.Hour * 24),
+	}
+}
+
+func TestDefaultTemplatesEscaping(t *testing.T) {
+	tests := []struct {
+		mode    string
+		escaped string
+	}{
+		{mode: "", escaped: hostile},
+		{mode: tgbotapi.ModeMarkdown, escaped: "\\_\\*\\[]()~\\`>#+-=|{}.! <&>"},
+		{mode: tgbotapi.ModeMarkdownV2, escaped: "\\_\\*\\[\\]\\(\\)\\~\\`\\>\\#\\+\\-\\=\\|\\{\\}\\.\\! <&\\>"},
+		{mode: tgbotapi.ModeHTML, escaped: "_*[]()~`&gt;#+-=|{}.! &lt;&amp;&gt;"},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			m, err := newMessageTemplates(tt.mode, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for kind := range defaultTemplates[tt.mode] {
+				text, err := m.render(hostileData(kind))
+				if err != nil {
+					t.Fatalf("%s: %v", kind, err)
+				}
+
+				if kind == KindBreakerClosed {
+					// no values are printed
+					continue
+				}
+				if !strings.Contains(text, tt.escaped) {
+					t.Errorf("%s: the value is not escaped in %q", kind, text)
+				}
+				if tt.escaped != hostile && strings.Contains(text, hostile) {
+					t.Errorf("%s: the raw value is in %q", kind, text)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownV2EscapesBackslash(t *testing.T) {
+	m, err := newMessageTemplates(tgbotapi.ModeMarkdownV2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := hostileData(KindError)
+	data.Error = `C:\path\_`
+	text, err := m.render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "`C:\\\\path\\\\\\_`"; !strings.Contains(text, want) {
+		t.Errorf("rendered %q, want %q in it", text, want)
+	}
+}
+
+func TestEscapeActions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "field",
+			text: "{{ .Error }}",
+			want: "&lt;b&gt;",
+		},
+		{
+			name: "pipeline",
+			text: `{{ .Error | printf "%s!" }}`,
+			want: "&lt;b&gt;!",
+		},
+		{
+			name: "function",
+			text: `{{ printf "<%s>" .Error }}`,
+			want: "&lt;&lt;b&gt;&gt;",
+		},
+		{
+			name: "raw",
+			text: "{{ .Error | raw }}, {{ raw .Error }}",
+			want: "<b>, <b>",
+		},
+		{
+			name: "already escaped",
+			text: "{{ .Error | html }}, {{ html .Error }}",
+			want: "&lt;b&gt;, &lt;b&gt;",
+		},
+		{
+			name: "variable",
+			text: "{{ $e := .Error }}{{ $e }}",
+			want: "&lt;b&gt;",
+		},
+		{
+			name: "if",
+			text: "{{ if .Error }}{{ .Error }}{{ else }}{{ .URL }}{{ end }}{{ if not .Error }}{{ .Error }}{{ else }}{{ .URL }}{{ end }}",
+			want: "&lt;b&gt;&lt;i&gt;",
+		},
+		{
+			name: "with",
+			text: "{{ with .Error }}{{ . }}{{ end }}{{ with .Holiday }}{{ . }}{{ else }}{{ $.URL }}{{ end }}",
+			want: "&lt;b&gt;&lt;i&gt;",
+		},
+		{
+			name: "range",
+			text: "{{ range .Screenshot }}{{ $.Error }}{{ end }}{{ range slice .Screenshot 0 0 }}{{ . }}{{ else }}{{ $.URL }}{{ end }}",
+			want: "&lt;b&gt;&lt;i&gt;",
+		},
+		{
+			name: "defined template",
+			text: `{{ define "err" }}{{ .Error }}{{ end }}{{ template "err" . }}`,
+			want: "&lt;b&gt;",
+		},
+		{
+			name: "text is left as is",
+			text: "<b>{{ .Error }}</b>",
+			want: "<b>&lt;b&gt;</b>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMessageTemplates(tgbotapi.ModeHTML, map[NotificationKind]string{KindError: tt.text})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := messageData{Kind: KindError, Result: Result{Error: "<b>", URL: "<i>", Screenshot: []byte{1}}}
+			got, err := m.render(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,11 +11,46 @@ var (
 		Name: "prufen_success_scenarios_run_total",
 		Help: "Number of founded appointments",
 	})
+	outboxDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "prufen_outbox_queue_depth",
+		Help: "Number of notifications awaiting the delivery",
+	})
+	notificationsSentTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "prufen_notifications_sent_total",
+		Help: "Number of delivered notifications",
+	})
+	notificationsFailedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "prufen_notifications_failed_total",
+		Help: "Number of failed notification delivery attempts",
+	})
+	notificationsDroppedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "prufen_notifications_dropped_total",
+		Help: "Number of notifications dropped without the delivery",
+	})
+	skippedRunsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "prufen_skipped_runs_total",
+		Help: "Number of runs skipped or cancelled according to the overlap policy",
+	})
+	consecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prufen_consecutive_failed_polls",
+		Help: "Number of consecutive polls with all runs failed",
+	}, []string{"watch"})
+	breakerStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prufen_circuit_breaker_state",
+		Help: "Current state of the circuit breaker around polls, 1 for the current one",
+	}, []string{"watch", "state"})
 )
 
 func init() {
 	prometheus.MustRegister(
 		scenariosTotal,
 		successScenariosTotal,
+		outboxDepth,
+		notificationsSentTotal,
+		notificationsFailedTotal,
+		notificationsDroppedTotal,
+		skippedRunsTotal,
+		consecutiveFailures,
+		breakerStateGauge,
 	)
 }
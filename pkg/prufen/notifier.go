@@ -0,0 +1,122 @@
+package prufen
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type (
+	// notifier delivers notifications to a single destination.
+	notifier interface {
+		// id identifies the destination, it's used to route queued
+		// notifications after restarts.
+		id() string
+		// wants reports whether the destination is subscribed to the kind.
+		wants(kind NotificationKind) bool
+		// notify delivers a single notification.
+		notify(ctx context.Context, data messageData) error
+	}
+
+	// telegramNotifier sends notifications to a single Telegram recipient.
+	telegramNotifier struct {
+		r  *Runner
+		to TelegramRecipient
+		// escalationOnly recipients get only escalated alerts addressed to them.
+		escalationOnly bool
+	}
+)
+
+func (n *telegramNotifier) id() string {
+	return "telegram:" + n.to.String()
+}
+
+func (n *telegramNotifier) wants(kind NotificationKind) bool {
+	return !n.escalationOnly && n.to.Level.includes(kind)
+}
+
+func (n *telegramNotifier) notify(_ context.Context, data messageData) error {
+	text, err := n.r.templates.render(data)
+	if err != nil {
+		return permanentError{err}
+	}
+
+	var markup *tgbotapi.InlineKeyboardMarkup
+	switch {
+	case data.Kind.actionable():
+		markup = slotsKeyboard(data)
+	case data.AlertID != "":
+		markup = ackKeyboard(data.AlertID)
+	}
+
+	if data.Kind.withScreenshot() && len(data.Screenshot) > 0 {
+		return n.r.sendPhoto(n.to, text, data.Screenshot, markup)
+	}
+
+	return n.r.sendMessage(n.to, text, markup)
+}
+
+// register adds the notifier to the configured ones, it returns
+// the already configured notifier with the same id if there is one.
+func (r *Runner) register(n notifier) notifier {
+	for _, cur := range r.notifiers {
+		if cur.id() == n.id() {
+			return cur
+		}
+	}
+	r.notifiers = append(r.notifiers, n)
+
+	return n
+}
+
+// configuredNotifier reports whether the notifier with the given id is configured.
+func (r *Runner) configuredNotifier(id string) bool {
+	for _, n := range r.notifiers {
+		if n.id() == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notifierByID returns the configured notifier or the subscriber
+// notifier with the given id.
+func (r *Runner) notifierByID(id string) (notifier, bool) {
+	for _, n := range r.notifiers {
+		if n.id() == id {
+			return n, true
+		}
+	}
+
+	if r.subs == nil {
+		return nil, false
+	}
+	chat, ok := strings.CutPrefix(id, "telegram:")
+	if !ok {
+		return nil, false
+	}
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	if _, ok := r.subs.get(chatID); !ok {
+		return nil, false
+	}
+
+	return r.subscriberNotifier(chatID), true
+}
+
+// withoutTelegram filters the telegram notifiers out.
+func withoutTelegram(notifiers []notifier) []notifier {
+	var res []notifier
+	for _, n := range notifiers {
+		if _, ok := n.(*telegramNotifier); !ok {
+			res = append(res, n)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,92 @@
+package prufen
+
+import "time"
+
+type (
+	// notifyState tracks the availability of slots to notify
+	// only about its transitions.
+	notifyState struct {
+		Availability availability `json:"availability,omitempty"`
+		// ChangedAt is the time of the last availability transition.
+		ChangedAt time.Time `json:"changed_at,omitempty"`
+		// NotifiedAt is the time of the last notification about available slots.
+		NotifiedAt time.Time `json:"notified_at,omitempty"`
+		// Notified is set if the current available period has been notified about.
+		Notified bool `json:"notified,omitempty"`
+		// Dismissed is set if the current available period has been marked
+		// as not useful, no reminders are sent about it.
+		Dismissed bool `json:"dismissed,omitempty"`
+		// Done is set once slots of the profile have been booked,
+		// the profile is not checked anymore.
+		Done bool `json:"done,omitempty"`
+		// Errors is the number of consecutive failed runs.
+		Errors int `json:"errors,omitempty"`
+	}
+
+	availability string
+)
+
+const (
+	availabilityUnknown availability = ""
+	availabilityNone    availability = "none"
+	availabilityOpen    availability = "available"
+)
+
+// transit moves the state according to the result and returns
+// the kind of notification to send, if any.
+func (s *notifyState) transit(res Result, cooldown, reminder time.Duration) (NotificationKind, bool) {
+	if res.Error != "" {
+		s.Errors++
+		return KindError, true
+	}
+	s.Errors = 0
+
+	now := res.StartedAt
+	prev := s.Availability
+
+	if !res.SlotsAvailable {
+		wasNotified := s.Notified
+		if prev != availabilityNone {
+			s.ChangedAt = now
+		}
+		s.Availability, s.Notified, s.Dismissed = availabilityNone, false, false
+
+		switch {
+		case prev == availabilityOpen && wasNotified:
+			return KindSlotsGone, true
+		case prev == availabilityUnknown:
+			return KindNoSlots, true
+		}
+
+		return "", false
+	}
+
+	if prev != availabilityOpen {
+		s.Availability = availabilityOpen
+		s.ChangedAt = now
+
+		// flapping availability does not make a new alert within the cooldown
+		if now.Sub(s.NotifiedAt) < cooldown {
+			return "", false
+		}
+
+		s.Notified, s.NotifiedAt = true, now
+		return KindSlots, true
+	}
+
+	if !s.Notified {
+		// the cooldown has passed while slots are still available
+		if now.Sub(s.NotifiedAt) >= cooldown {
+			s.Notified, s.NotifiedAt = true, now
+			return KindSlots, true
+		}
+		return "", false
+	}
+
+	if reminder > 0 && !s.Dismissed && now.Sub(s.NotifiedAt) >= reminder {
+		s.NotifiedAt = now
+		return KindSlotsReminder, true
+	}
+
+	return "", false
+}
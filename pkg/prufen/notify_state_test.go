@@ -0,0 +1,153 @@
+package prufen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotifyStateTransit(t *testing.T) {
+	type step struct {
+		at    time.Duration
+		slots bool
+		err   bool
+		// dismiss marks the slots as not useful instead of a run
+		dismiss bool
+		want    NotificationKind
+	}
+
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		reminder time.Duration
+		steps    []step
+	}{
+		{
+			name: "none to available",
+			steps: []step{
+				{at: 0, want: KindNoSlots},
+				{at: time.Minute},
+				{at: time.Minute * 2, slots: true, want: KindSlots},
+				{at: time.Minute * 3, slots: true},
+			},
+		},
+		{
+			name: "available from the start",
+			steps: []step{
+				{at: 0, slots: true, want: KindSlots},
+			},
+		},
+		{
+			name: "available to gone",
+			steps: []step{
+				{at: 0, slots: true, want: KindSlots},
+				{at: time.Minute, want: KindSlotsGone},
+				{at: time.Minute * 2},
+			},
+		},
+		{
+			name:     "flapping within the cooldown",
+			cooldown: time.Minute * 10,
+			steps: []step{
+				{at: 0, slots: true, want: KindSlots},
+				{at: time.Minute, want: KindSlotsGone},
+				{at: time.Minute * 2, slots: true},
+				{at: time.Minute * 3},
+				{at: time.Minute * 4, slots: true},
+				{at: time.Minute * 9, slots: true},
+				{at: time.Minute * 10, slots: true, want: KindSlots},
+				{at: time.Minute * 11, want: KindSlotsGone},
+			},
+		},
+		{
+			name:     "available again after the cooldown",
+			cooldown: time.Minute * 10,
+			steps: []step{
+				{at: 0, slots: true, want: KindSlots},
+				{at: time.Minute, want: KindSlotsGone},
+				{at: time.Minute * 15, slots: true, want: KindSlots},
+			},
+		},
+		{
+			name:     "reminder interval",
+			reminder: time.Minute * 30,
+			steps: []step{
+				{at: 0, slots: true, want: KindSlots},
+				{at: time.Minute * 10, slots: true},
+				{at: time.Minute * 30, slots: true, want: KindSlotsReminder},
+				{at: time.Minute * 50, slots: true},
+				{at: time.Minute * 60, slots: true, want: KindSlotsReminder},
+				{at: time.Minute * 61, want: KindSlotsGone},
+			},
+		},
+		{
+			name: "no reminders without the interval",
+			steps: []step{
+				{at: 0, slots: true, want: KindSlots},
+				{at: time.Hour * 24, slots: true},
+			},
+		},
+		{
+			name:     "not useful dismissal",
+			reminder: time.Minute * 30,
+			steps: []step{
+				{at: 0, slots: true, want: KindSlots},
+				{at: time.Minute, dismiss: true},
+				{at: time.Minute * 30, slots: true},
+				{at: time.Minute * 90, slots: true},
+				{at: time.Minute * 91, want: KindSlotsGone},
+				{at: time.Minute * 92, slots: true, want: KindSlots},
+				{at: time.Minute * 122, slots: true, want: KindSlotsReminder},
+			},
+		},
+		{
+			name: "errors keep the availability",
+			steps: []step{
+				{at: 0, slots: true, want: KindSlots},
+				{at: time.Minute, err: true, want: KindError},
+				{at: time.Minute * 2, err: true, want: KindError},
+				{at: time.Minute * 3, slots: true},
+				{at: time.Minute * 4, want: KindSlotsGone},
+			},
+		},
+	}
+
+	start := time.Date(2023, time.March, 6, 9, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s notifyState
+			for i, st := range tt.steps {
+				if st.dismiss {
+					s.Dismissed = true
+					continue
+				}
+
+				res := Result{StartedAt: start.Add(st.at), SlotsAvailable: st.slots}
+				if st.err {
+					res.Error = "failed"
+				}
+
+				kind, ok := s.transit(res, tt.cooldown, tt.reminder)
+				if kind != st.want || ok != (st.want != "") {
+					t.Fatalf("step #%d at %s: transit() = %q, %v, want %q", i, st.at, kind, ok, st.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifyStateErrors(t *testing.T) {
+	var s notifyState
+	start := time.Date(2023, time.March, 6, 9, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 3; i++ {
+		s.transit(Result{StartedAt: start, Error: "failed"}, 0, 0)
+		if s.Errors != i {
+			t.Fatalf("%d errors are counted, want %d", s.Errors, i)
+		}
+	}
+
+	s.transit(Result{StartedAt: start}, 0, 0)
+	if s.Errors != 0 {
+		t.Errorf("%d errors are counted after a successful run, want 0", s.Errors)
+	}
+}
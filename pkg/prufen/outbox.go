@@ -0,0 +1,454 @@
+package prufen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	outboxFileName = "outbox.json"
+	// outboxScreenshotsDir keeps the screenshots of queued notifications,
+	// each once for all of the recipients, so the queue file stays small.
+	outboxScreenshotsDir = "outbox_screenshots"
+
+	outboxMinBackoff = time.Second
+	outboxMaxBackoff = time.Minute * 5
+	// outboxMaxAge is the age after which notifications are no longer
+	// useful and are dropped from the outbox.
+	outboxMaxAge = time.Hour * 24
+	// outboxMaxExitAttempts is the number of attempts after which exec hooks
+	// exiting with a non-zero code are no longer retried.
+	outboxMaxExitAttempts = 3
+)
+
+type (
+	// outbox is a queue of notifications which are delivered in the
+	// background, it's persisted in the state directory if any.
+	outbox struct {
+		mu    sync.Mutex
+		path  string
+		seq   uint64
+		items []*outboxItem
+		// screenshots are referenced by the items by the ScreenshotID.
+		screenshots map[uint64][]byte
+		// busy notifiers have an item being delivered, their other items
+		// wait, so a slow notifier doesn't hold up the others.
+		busy map[string]bool
+		// wake signals the delivery loop about new items.
+		wake chan struct{}
+	}
+
+	// outboxItem is a single notification to a single destination.
+	outboxItem struct {
+		ID         uint64      `json:"id"`
+		NotifierID string      `json:"notifier_id"`
+		Data       messageData `json:"data"`
+		// ScreenshotID refers to the screenshot of the Data shared by all of
+		// the recipients, it's kept separately since the Result omits it.
+		ScreenshotID uint64    `json:"screenshot_id,omitempty"`
+		CreatedAt    time.Time `json:"created_at"`
+		Attempts     int       `json:"attempts,omitempty"`
+		NextAttempt  time.Time `json:"next_attempt"`
+		LastError    string    `json:"last_error,omitempty"`
+	}
+
+	outboxFile struct {
+		Seq   uint64        `json:"seq"`
+		Items []*outboxItem `json:"items"`
+	}
+
+	// permanentError is a delivery error retries would not help with,
+	// e.g. a broken message template.
+	permanentError struct {
+		error
+	}
+)
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// deliveryRetry reports whether the delivery should be retried after
+// the error of the given attempt, and the delay requested by Telegram if any.
+// Telegram client errors, such as unparsable entities or an unknown chat,
+// are permanent except the flood control. Exec hooks which could not be found
+// are permanent too, and the ones exiting with a non-zero code after
+// the outboxMaxExitAttempts.
+func deliveryRetry(err error, attempt int) (bool, time.Duration) {
+	if errors.As(err, &permanentError{}) || errors.Is(err, exec.ErrNotFound) {
+		return false, 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return attempt < outboxMaxExitAttempts, 0
+	}
+
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return true, 0
+	}
+	switch {
+	case tgErr.Code == http.StatusTooManyRequests:
+		return true, time.Duration(tgErr.RetryAfter) * time.Second
+	case tgErr.Code >= http.StatusBadRequest && tgErr.Code < http.StatusInternalServerError:
+		return false, 0
+	default:
+		return true, 0
+	}
+}
+
+func newOutbox(stateDir string) (*outbox, error) {
+	o := &outbox{
+		screenshots: map[uint64][]byte{},
+		busy:        map[string]bool{},
+		wake:        make(chan struct{}, 1),
+	}
+	if stateDir == "" {
+		return o, nil
+	}
+
+	o.path = filepath.Join(stateDir, outboxFileName)
+	if err := os.MkdirAll(o.screenshotsPath(), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox screenshots dir: %w", err)
+	}
+
+	var f outboxFile
+	if err := readJSONFile(o.path, &f); err != nil {
+		return nil, err
+	}
+	for _, it := range f.Items {
+		if it.ScreenshotID == 0 {
+			continue
+		}
+		if _, ok := o.screenshots[it.ScreenshotID]; !ok {
+			bb, err := os.ReadFile(o.screenshotPath(it.ScreenshotID))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("failed to read outbox screenshot: %w", err)
+			}
+			o.screenshots[it.ScreenshotID] = bb
+		}
+		it.Data.Screenshot = o.screenshots[it.ScreenshotID]
+	}
+	o.seq, o.items = f.Seq, f.Items
+	outboxDepth.Set(float64(len(o.items)))
+
+	return o, nil
+}
+
+// enqueue adds a notification to each of the given notifiers into the queue.
+func (o *outbox) enqueue(notifierIDs []string, data messageData) error {
+	if len(notifierIDs) == 0 {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var screenshotID uint64
+	if len(data.Screenshot) > 0 {
+		screenshotID = o.seq + 1
+		o.screenshots[screenshotID] = data.Screenshot
+		if o.path != "" {
+			if err := os.WriteFile(o.screenshotPath(screenshotID), data.Screenshot, 0o644); err != nil {
+				delete(o.screenshots, screenshotID)
+				return fmt.Errorf("failed to write outbox screenshot: %w", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, id := range notifierIDs {
+		o.seq++
+		o.items = append(o.items, &outboxItem{
+			ID:           o.seq,
+			NotifierID:   id,
+			Data:         data,
+			ScreenshotID: screenshotID,
+			CreatedAt:    now,
+			NextAttempt:  now,
+		})
+	}
+	outboxDepth.Set(float64(len(o.items)))
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return o.save()
+}
+
+// due returns the next item to deliver, or the time until the next
+// attempt if nothing is due yet. Items of busy notifiers are skipped,
+// the notifier of the returned item is busy until the item is released.
+func (o *outbox) due(now time.Time) (*outboxItem, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var next *outboxItem
+	for _, it := range o.items {
+		if o.busy[it.NotifierID] {
+			continue
+		}
+		if next == nil || it.NextAttempt.Before(next.NextAttempt) {
+			next = it
+		}
+	}
+
+	switch {
+	case next == nil:
+		return nil, -1
+	case next.NextAttempt.After(now):
+		return nil, next.NextAttempt.Sub(now)
+	default:
+		o.busy[next.NotifierID] = true
+		return next, 0
+	}
+}
+
+// release marks the notifier of the item as no longer busy.
+func (o *outbox) release(item *outboxItem) {
+	o.mu.Lock()
+	delete(o.busy, item.NotifierID)
+	o.mu.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// done removes the item from the queue.
+func (o *outbox) done(item *outboxItem) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, it := range o.items {
+		if it.ID == item.ID {
+			o.items = append(o.items[:i], o.items[i+1:]...)
+			break
+		}
+	}
+	outboxDepth.Set(float64(len(o.items)))
+
+	if err := o.save(); err != nil {
+		return err
+	}
+
+	return o.releaseScreenshot(item.ScreenshotID)
+}
+
+// releaseScreenshot removes the screenshot unless other items refer to it.
+// Must be called with the mu held.
+func (o *outbox) releaseScreenshot(id uint64) error {
+	if id == 0 {
+		return nil
+	}
+	for _, it := range o.items {
+		if it.ScreenshotID == id {
+			return nil
+		}
+	}
+
+	delete(o.screenshots, id)
+	if o.path == "" {
+		return nil
+	}
+	if err := os.Remove(o.screenshotPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove outbox screenshot: %w", err)
+	}
+
+	return nil
+}
+
+func (o *outbox) screenshotsPath() string {
+	return filepath.Join(filepath.Dir(o.path), outboxScreenshotsDir)
+}
+
+func (o *outbox) screenshotPath(id uint64) string {
+	return filepath.Join(o.screenshotsPath(), strconv.FormatUint(id, 10)+".jpg")
+}
+
+// retry reschedules the item with an exponential backoff and jitter,
+// or after the given delay if it's longer.
+func (o *outbox) retry(item *outboxItem, err error, after time.Duration) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	item.Attempts++
+	item.LastError = err.Error()
+
+	backoff := outboxMaxBackoff
+	if item.Attempts < 16 && outboxMinBackoff<<(item.Attempts-1) < outboxMaxBackoff {
+		backoff = outboxMinBackoff << (item.Attempts - 1)
+	}
+	// full jitter on the upper half to spread retries
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	if backoff < after {
+		backoff = after
+	}
+	item.NextAttempt = time.Now().Add(backoff)
+
+	return o.save()
+}
+
+func (o *outbox) len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.items)
+}
+
+// save must be called with the mu held.
+func (o *outbox) save() error {
+	if o.path == "" {
+		return nil
+	}
+
+	return writeJSONFile(o.path, outboxFile{Seq: o.seq, Items: o.items})
+}
+
+// notify enqueues the notification to every subscribed notifier among the targets.
+func (r *Runner) notify(data messageData, targets []notifier) {
+	if now := time.Now(); !r.officeHours.open(now) {
+		data.OfficeClosed = true
+		data.Holiday, _ = berlinHoliday(now)
+		data.NextBusinessDay = r.officeHours.nextOpening(now)
+	}
+
+	var ids []string
+	for _, n := range targets {
+		if n.wants(data.Kind) {
+			ids = append(ids, n.id())
+		}
+	}
+
+	if err := r.outbox.enqueue(ids, data); err != nil {
+		r.logger.Error("failed to persist notification", "notifiers", ids, "error", err)
+	}
+}
+
+// deliver sends queued notifications until the context is done. Each of
+// the notifiers is delivered to concurrently, so a hanging exec hook doesn't
+// delay Telegram messages.
+func (r *Runner) deliver(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		item, wait := r.outbox.due(time.Now())
+		if item != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.deliverItem(ctx, item)
+			}()
+			continue
+		}
+
+		var (
+			timer *time.Timer
+			fire  <-chan time.Time
+		)
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			fire = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-r.outbox.wake:
+		case <-fire:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// DeliverPending synchronously delivers queued notifications until
+// the queue is empty or the context is done. It could be used
+// along with the RunFullCycle instead of running the Runner.
+func (r *Runner) DeliverPending(ctx context.Context) error {
+	for r.outbox.len() > 0 {
+		item, wait := r.outbox.due(time.Now())
+		if item != nil {
+			r.deliverItem(ctx, item)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) deliverItem(ctx context.Context, item *outboxItem) {
+	defer r.outbox.release(item)
+
+	l := r.logger.With("notifier", item.NotifierID, "kind", item.Data.Kind, "attempts", item.Attempts)
+
+	n, ok := r.notifierByID(item.NotifierID)
+	if !ok {
+		l.Warn("dropping notification to unknown notifier")
+		notificationsDroppedTotal.Inc()
+		r.dropItem(item)
+		return
+	}
+
+	err := n.notify(ctx, item.Data)
+	if err == nil {
+		notificationsSentTotal.Inc()
+		r.events.publish(eventNotificationSent, map[string]any{"notifier": item.NotifierID, "kind": item.Data.Kind})
+		r.dropItem(item)
+		return
+	}
+
+	notificationsFailedTotal.Inc()
+	r.events.publish(eventError, map[string]any{"notifier": item.NotifierID, "kind": item.Data.Kind, "error": err.Error()})
+	retry, after := deliveryRetry(err, item.Attempts+1)
+	if !retry {
+		l.Error("dropping notification failed permanently", "error", err)
+		notificationsDroppedTotal.Inc()
+		r.dropItem(item)
+		return
+	}
+	if time.Since(item.CreatedAt) > outboxMaxAge {
+		l.Error("dropping expired notification", "error", err)
+		notificationsDroppedTotal.Inc()
+		r.dropItem(item)
+		return
+	}
+
+	l.Error("failed to deliver notification, will retry", "error", err)
+	if err := r.outbox.retry(item, err, after); err != nil {
+		r.logger.Error("failed to persist outbox", "error", err)
+	}
+}
+
+func (r *Runner) dropItem(item *outboxItem) {
+	if err := r.outbox.done(item); err != nil {
+		r.logger.Error("failed to persist outbox", "error", err)
+	}
+}
@@ -0,0 +1,199 @@
+package prufen
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/exp/slog"
+)
+
+func TestDeliveryRetry(t *testing.T) {
+	tgError := func(code, retryAfter int) error {
+		err := &tgbotapi.Error{Code: code, Message: "error", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: retryAfter}}
+		return fmt.Errorf("failed to send message to telegram chat 1: %w", err)
+	}
+
+	notFoundErr := exec.Command("prufen-no-such-hook").Run()
+	exitErr := exec.Command("sh", "-c", "exit 1").Run()
+	killedErr := exec.Command("sh", "-c", "kill -9 $$").Run()
+
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		retry   bool
+		after   time.Duration
+	}{
+		{name: "network", err: errors.New("connection refused"), retry: true},
+		{name: "template", err: permanentError{errors.New("failed to render")}},
+		{name: "can't parse entities", err: tgError(400, 0)},
+		{name: "chat not found", err: tgError(400, 0)},
+		{name: "blocked by the user", err: tgError(403, 0)},
+		{name: "flood control", err: tgError(429, 30), retry: true, after: time.Second * 30},
+		{name: "server error", err: tgError(502, 0), retry: true},
+		{name: "hook not found", err: fmt.Errorf("exec hook failed: %w", notFoundErr), attempt: 1},
+		{name: "hook exit code", err: fmt.Errorf("exec hook failed: %w", exitErr), attempt: 1, retry: true},
+		{name: "hook exit code on the last attempt", err: exitErr, attempt: outboxMaxExitAttempts},
+		{name: "hook killed", err: killedErr, attempt: outboxMaxExitAttempts, retry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry, after := deliveryRetry(tt.err, tt.attempt)
+			if retry != tt.retry || after != tt.after {
+				t.Errorf("deliveryRetry() = %v, %s, want %v, %s", retry, after, tt.retry, tt.after)
+			}
+		})
+	}
+}
+
+func TestOutboxScreenshots(t *testing.T) {
+	dir := t.TempDir()
+	o, err := newOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	screenshot := []byte("jpeg")
+	data := messageData{Result: Result{Screenshot: screenshot}, Kind: KindSlots}
+	if err := o.enqueue([]string{"telegram:1", "telegram:2", "telegram:3"}, data); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := os.ReadFile(filepath.Join(dir, outboxFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(queue, []byte(base64.StdEncoding.EncodeToString(screenshot))) {
+		t.Error("the screenshot is stored in the queue file")
+	}
+	files, err := os.ReadDir(filepath.Join(dir, outboxScreenshotsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("%d screenshots are stored, want 1", len(files))
+	}
+
+	restored, err := newOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.len() != 3 {
+		t.Fatalf("%d items are restored, want 3", restored.len())
+	}
+	for _, it := range restored.items {
+		if !bytes.Equal(it.Data.Screenshot, screenshot) {
+			t.Errorf("item %d has screenshot %q, want %q", it.ID, it.Data.Screenshot, screenshot)
+		}
+	}
+
+	for _, it := range append([]*outboxItem(nil), restored.items...) {
+		if err := restored.done(it); err != nil {
+			t.Fatal(err)
+		}
+		want := 1
+		if restored.len() == 0 {
+			want = 0
+		}
+		if files, _ := os.ReadDir(filepath.Join(dir, outboxScreenshotsDir)); len(files) != want {
+			t.Errorf("%d screenshots are left with %d items, want %d", len(files), restored.len(), want)
+		}
+	}
+}
+
+func TestExecNotifierMissingCommand(t *testing.T) {
+	n := &execNotifier{
+		hook:   ExecHook{Name: "missing", Command: []string{filepath.Join(t.TempDir(), "hook")}, Timeout: time.Second},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	err := n.notify(context.Background(), messageData{Kind: KindSlots})
+	if retry, _ := deliveryRetry(err, 1); err == nil || retry {
+		t.Errorf("notify() = %v, want a permanent error", err)
+	}
+}
+
+// blockingNotifier delivers only once its context is done.
+type blockingNotifier struct {
+	name    string
+	started chan struct{}
+}
+
+func (n *blockingNotifier) id() string                  { return n.name }
+func (n *blockingNotifier) wants(NotificationKind) bool { return true }
+
+func (n *blockingNotifier) notify(ctx context.Context, _ messageData) error {
+	close(n.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// recordingNotifier reports each of the delivered notifications.
+type recordingNotifier struct {
+	name      string
+	delivered chan NotificationKind
+}
+
+func (n *recordingNotifier) id() string                  { return n.name }
+func (n *recordingNotifier) wants(NotificationKind) bool { return true }
+
+func (n *recordingNotifier) notify(_ context.Context, data messageData) error {
+	n.delivered <- data.Kind
+	return nil
+}
+
+func TestDeliverPerNotifier(t *testing.T) {
+	o, err := newOutbox("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &blockingNotifier{name: "exec:slow", started: make(chan struct{})}
+	tg := &recordingNotifier{name: "telegram:1", delivered: make(chan NotificationKind)}
+	r := &Runner{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		outbox:    o,
+		notifiers: []notifier{hook, tg},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.deliver(ctx)
+		close(done)
+	}()
+
+	if err := o.enqueue([]string{hook.id()}, messageData{Kind: KindSlots}); err != nil {
+		t.Fatal(err)
+	}
+	<-hook.started
+	if err := o.enqueue([]string{hook.id(), tg.id()}, messageData{Kind: KindSlotsGone}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case kind := <-tg.delivered:
+		if kind != KindSlotsGone {
+			t.Errorf("%s is delivered, want %s", kind, KindSlotsGone)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("telegram notification is held up by the hanging hook")
+	}
+
+	cancel()
+	<-done
+	if n := o.len(); n != 2 {
+		t.Errorf("%d items are left in the outbox, want 2 of the hook", n)
+	}
+}
@@ -0,0 +1,130 @@
+package prufen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// OverlapPolicy defines what happens to a run of a profile
+// which is requested while another run of it is in progress.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip skips the new run.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueueOne starts the new run once the current one is finished,
+	// at most one run is queued, others are skipped.
+	OverlapQueueOne OverlapPolicy = "queue-one"
+	// OverlapCancelPrevious cancels the current run and starts the new one,
+	// only the newest of the runs requested meanwhile is started.
+	OverlapCancelPrevious OverlapPolicy = "cancel-previous"
+)
+
+type (
+	// runLocks allow a single run per profile at a time.
+	runLocks struct {
+		mu        sync.Mutex
+		policy    OverlapPolicy
+		byProfile map[string]*profileRun
+		// latest is the ticket of the newest run awaiting the cancelled one
+		// per profile, older ones are skipped.
+		latest  map[string]uint64
+		tickets uint64
+	}
+
+	// profileRun is a run of a profile in progress.
+	profileRun struct {
+		cancel context.CancelFunc
+		// done is closed once the run is finished.
+		done chan struct{}
+		// queued is set if another run awaits this one.
+		queued bool
+	}
+)
+
+func (p OverlapPolicy) validate() error {
+	switch p {
+	case OverlapSkip, OverlapQueueOne, OverlapCancelPrevious:
+		return nil
+	default:
+		return fmt.Errorf("unknown overlap policy %q", p)
+	}
+}
+
+func newRunLocks(policy OverlapPolicy) *runLocks {
+	return &runLocks{
+		policy:    policy,
+		byProfile: map[string]*profileRun{},
+		latest:    map[string]uint64{},
+	}
+}
+
+// acquire starts a run of the profile according to the policy, it returns
+// the context of the run and the function to release it once it's finished.
+// It returns false if the run is skipped.
+func (l *runLocks) acquire(parent context.Context, p Profile) (context.Context, func(), bool) {
+	key := p.key()
+
+	l.mu.Lock()
+	var ticket uint64
+	for {
+		if ticket != 0 && l.latest[key] != ticket {
+			// a newer run has cancelled the previous one as well
+			l.mu.Unlock()
+			skippedRunsTotal.Inc()
+			return nil, nil, false
+		}
+
+		cur, ok := l.byProfile[key]
+		if !ok {
+			break
+		}
+
+		switch l.policy {
+		case OverlapQueueOne:
+			if cur.queued {
+				l.mu.Unlock()
+				skippedRunsTotal.Inc()
+				return nil, nil, false
+			}
+			cur.queued = true
+		case OverlapCancelPrevious:
+			if ticket == 0 {
+				l.tickets++
+				ticket = l.tickets
+				l.latest[key] = ticket
+			}
+			cur.cancel()
+		default:
+			l.mu.Unlock()
+			skippedRunsTotal.Inc()
+			return nil, nil, false
+		}
+
+		// another run could take the lock in between, hence the loop
+		l.mu.Unlock()
+		<-cur.done
+		l.mu.Lock()
+	}
+
+	// older runs awaiting the cancelled one are superseded by this one
+	delete(l.latest, key)
+
+	ctx, cancel := context.WithCancel(parent)
+	run := &profileRun{cancel: cancel, done: make(chan struct{})}
+	l.byProfile[key] = run
+	l.mu.Unlock()
+
+	release := func() {
+		cancel()
+
+		l.mu.Lock()
+		delete(l.byProfile, key)
+		l.mu.Unlock()
+
+		close(run.done)
+	}
+
+	return ctx, release, true
+}
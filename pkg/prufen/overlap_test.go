@@ -0,0 +1,201 @@
+package prufen
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// acquireResult is the outcome of a run lock acquired in background.
+type acquireResult struct {
+	ctx     context.Context
+	release func()
+	ok      bool
+}
+
+func acquireAsync(l *runLocks, p Profile) chan acquireResult {
+	res := make(chan acquireResult, 1)
+	go func() {
+		ctx, release, ok := l.acquire(context.Background(), p)
+		res <- acquireResult{ctx: ctx, release: release, ok: ok}
+	}()
+
+	return res
+}
+
+// waitFor polls the condition checked with the mu of the locks held.
+func waitFor(t *testing.T, l *runLocks, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second * 5); ; {
+		l.mu.Lock()
+		ok := cond()
+		l.mu.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the condition is not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func assertPending(t *testing.T, res chan acquireResult) {
+	t.Helper()
+
+	select {
+	case r := <-res:
+		t.Fatalf("the run does not wait, ok: %v", r.ok)
+	case <-time.After(time.Millisecond * 20):
+	}
+}
+
+func receive(t *testing.T, res chan acquireResult) acquireResult {
+	t.Helper()
+
+	select {
+	case r := <-res:
+		return r
+	case <-time.After(time.Second * 5):
+		t.Fatal("the run is not started in time")
+		return acquireResult{}
+	}
+}
+
+func TestRunLocksSkip(t *testing.T) {
+	l := newRunLocks(OverlapSkip)
+	p := Profile{Citizenship: "Ukraine", PeopleNumber: "1"}
+
+	_, release, ok := l.acquire(context.Background(), p)
+	if !ok {
+		t.Fatal("the first run is skipped")
+	}
+	if _, _, ok := l.acquire(context.Background(), p); ok {
+		t.Fatal("the overlapping run is not skipped")
+	}
+
+	other := Profile{Citizenship: "India", PeopleNumber: "1"}
+	_, releaseOther, ok := l.acquire(context.Background(), other)
+	if !ok {
+		t.Fatal("the run of another profile is skipped")
+	}
+	releaseOther()
+
+	release()
+	_, release, ok = l.acquire(context.Background(), p)
+	if !ok {
+		t.Fatal("the run after the finished one is skipped")
+	}
+	release()
+}
+
+func TestRunLocksQueueOne(t *testing.T) {
+	l := newRunLocks(OverlapQueueOne)
+	p := Profile{Citizenship: "Ukraine", PeopleNumber: "1"}
+
+	ctx, release, ok := l.acquire(context.Background(), p)
+	if !ok {
+		t.Fatal("the first run is skipped")
+	}
+
+	queued := acquireAsync(l, p)
+	waitFor(t, l, func() bool { return l.byProfile[p.key()].queued })
+	assertPending(t, queued)
+
+	// only one run is queued, the others are skipped
+	for i := 0; i < 3; i++ {
+		if _, _, ok := l.acquire(context.Background(), p); ok {
+			t.Fatal("another run is queued")
+		}
+	}
+
+	release()
+	if ctx.Err() == nil {
+		t.Error("the context of the finished run is not done")
+	}
+
+	next := receive(t, queued)
+	if !next.ok {
+		t.Fatal("the queued run is skipped")
+	}
+	if next.ctx.Err() != nil {
+		t.Error("the queued run is cancelled")
+	}
+
+	// the queue is free again
+	queued = acquireAsync(l, p)
+	waitFor(t, l, func() bool { return l.byProfile[p.key()].queued })
+	next.release()
+	if last := receive(t, queued); !last.ok {
+		t.Fatal("the run queued after the previous one is skipped")
+	} else {
+		last.release()
+	}
+}
+
+func TestRunLocksCancelPrevious(t *testing.T) {
+	l := newRunLocks(OverlapCancelPrevious)
+	p := Profile{Citizenship: "Ukraine", PeopleNumber: "1"}
+
+	ctx, release, ok := l.acquire(context.Background(), p)
+	if !ok {
+		t.Fatal("the first run is skipped")
+	}
+
+	older := acquireAsync(l, p)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("the previous run is not cancelled")
+	}
+	waitFor(t, l, func() bool { return l.tickets == 1 })
+
+	newest := acquireAsync(l, p)
+	waitFor(t, l, func() bool { return l.tickets == 2 })
+	assertPending(t, older)
+	assertPending(t, newest)
+
+	// the cancelled run finishes, only the newest one is started
+	release()
+	if r := receive(t, older); r.ok {
+		t.Fatal("the older run is started")
+	}
+	r := receive(t, newest)
+	if !r.ok {
+		t.Fatal("the newest run is skipped")
+	}
+	if r.ctx.Err() != nil {
+		t.Error("the newest run is cancelled")
+	}
+	r.release()
+}
+
+func TestRunLocksCancelPreviousOvertaken(t *testing.T) {
+	l := newRunLocks(OverlapCancelPrevious)
+	p := Profile{Citizenship: "Ukraine", PeopleNumber: "1"}
+
+	if _, _, ok := l.acquire(context.Background(), p); !ok {
+		t.Fatal("the first run is skipped")
+	}
+	waiting := acquireAsync(l, p)
+	waitFor(t, l, func() bool { return l.tickets == 1 })
+
+	// a newer run takes the lock right after the cancelled run has released
+	// it, before the waiting one wakes up
+	l.mu.Lock()
+	run := l.byProfile[p.key()]
+	delete(l.byProfile, p.key())
+	l.mu.Unlock()
+
+	_, newest, ok := l.acquire(context.Background(), p)
+	if !ok {
+		t.Fatal("the newest run is skipped")
+	}
+	close(run.done)
+
+	if r := receive(t, waiting); r.ok {
+		t.Fatal("the older run has cancelled the newest one")
+	}
+	newest()
+}
@@ -0,0 +1,88 @@
+package prufen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Profile is a combination of the values filled into the ABH/LEA form.
+type Profile struct {
+	Citizenship             string `json:"citizenship"`
+	PeopleNumber            string `json:"people_number"`
+	LiveInBerlin            string `json:"live_in_berlin"`
+	FamilyMemberCitizenship string `json:"family_member_citizenship,omitempty"`
+	Reason                  string `json:"reason,omitempty"`
+	// Service is a key of the Service to check slots for,
+	// defaults to the DefaultService.
+	Service string `json:"service,omitempty"`
+}
+
+// key identifies distinct profiles.
+func (p Profile) key() string {
+	return strings.ToLower(strings.Join([]string{
+		p.Citizenship,
+		p.PeopleNumber,
+		p.LiveInBerlin,
+		p.FamilyMemberCitizenship,
+		p.Reason,
+		p.Service,
+	}, "|"))
+}
+
+// ref is a short form of the key to fit into the bot callback data.
+func (p Profile) ref() string {
+	sum := sha256.Sum256([]byte(p.key()))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Result describes a single scenario run.
+type Result struct {
+	Profile        Profile       `json:"profile"`
+	SlotsAvailable bool          `json:"slots_available"`
+	URL            string        `json:"url,omitempty"`
+	StartedAt      time.Time     `json:"started_at"`
+	Duration       time.Duration `json:"duration"`
+	Error          string        `json:"error,omitempty"`
+
+	// Screenshot is a JPEG image of the final page.
+	Screenshot []byte `json:"-"`
+}
+
+// NotificationKind distinguishes notifications sent after a run.
+type NotificationKind string
+
+const (
+	// KindSlots is sent when slots are available.
+	KindSlots NotificationKind = "slots"
+	// KindNoSlots is sent when no slots are available.
+	KindNoSlots NotificationKind = "no_slots"
+	// KindError is sent when a run has failed.
+	KindError NotificationKind = "error"
+	// KindSlotsGone is sent when previously available slots are gone.
+	KindSlotsGone NotificationKind = "slots_gone"
+	// KindSlotsReminder is sent while slots stay available.
+	KindSlotsReminder NotificationKind = "slots_reminder"
+	// KindEscalation is sent while available slots are not acknowledged.
+	KindEscalation NotificationKind = "escalation"
+	// KindBreakerOpen is sent when polls keep failing and only probes are run.
+	KindBreakerOpen NotificationKind = "breaker_open"
+	// KindBreakerClosed is sent when a poll succeeds after the breaker has opened.
+	KindBreakerClosed NotificationKind = "breaker_closed"
+	// KindStopped is sent when polling stops by one of the StopConditions.
+	KindStopped NotificationKind = "stopped"
+	// KindSubscriptionFailing is sent to the subscribers of a profile
+	// when its runs keep failing.
+	KindSubscriptionFailing NotificationKind = "subscription_failing"
+)
+
+// actionable reports whether notifications of the kind get the slots actions buttons.
+func (k NotificationKind) actionable() bool {
+	return k == KindSlots || k == KindSlotsReminder || k == KindEscalation
+}
+
+// withScreenshot reports whether notifications of the kind carry the screenshot.
+func (k NotificationKind) withScreenshot() bool {
+	return k == KindSlots || k == KindSlotsReminder
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -20,27 +22,60 @@ import (
 
 type Runner struct {
 	logger *slog.Logger
+	// logs are recent warnings and errors of the logger.
+	logs *recentLogs
 
 	botClient *tgbotapi.BotAPI
 
 	baseCtx         context.Context
 	debugf          func(string, ...any)
 	port            string
+	apiToken        string
 	screenshotsPath string
 
-	citizenship             string
-	peopleNumber            string
-	liveInBerlin            string
-	familyMemberCitizenship string
-	reason                  string
+	// watches poll the configured profiles, and the subscribers' ones.
+	watches               []*watch
+	services              map[string]Service
+	subs                  *subscriptions
+	subscriptionsEnabled  bool
+	subscribeCitizenships []string
+	maxSubscribedProfiles int
 
 	telegramAPIToken string
-	telegramChatID   int64
+	recipients       []TelegramRecipient
+	templates        *messageTemplates
+	notifiers        []notifier
+	outbox           *outbox
+	escalation       EscalationPolicy
+	adminChatIDs     []int64
+	// statusMessage enables the live-updating status message, statusMu
+	// serializes its updates, so concurrent polls do not send duplicates.
+	statusMessage bool
+	statusMu      sync.Mutex
+	// webhookURL receives the bot updates if set, otherwise they're long polled.
+	webhookURL    *url.URL
+	webhookSecret string
+
+	stateDir       string
+	stateMu        sync.Mutex
+	state          persistentState
+	notifyCooldown time.Duration
+	remindInterval time.Duration
 
 	opts                    []func(*chromedp.ExecAllocator)
 	runTimeout              time.Duration
-	pollInterval            time.Duration
+	runs                    *runLocks
+	limiter                 *runLimiter
+	stopper                 *stopper
+	officeHours             OfficeHours
+	readinessRunWindow      time.Duration
+	health                  healthCache
+	artifacts               artifacts
+	events                  eventBus
+	startedAt               time.Time
 	gracefulShutdownTimeout time.Duration
+
+	running atomic.Bool
 }
 
 type Options struct {
@@ -62,22 +97,117 @@ type Options struct {
 
 	// PollInterval sets the interval between the scenario runs.
 	PollInterval time.Duration
+	// Schedule changes the PollInterval within time windows, optional.
+	Schedule *Schedule
+	// OfficeHours of the ABH are used by the schedule windows and mentioned
+	// in notifications, default to Monday to Friday from the DefaultOfficeHoursFrom
+	// to the DefaultOfficeHoursTo except the Berlin public holidays.
+	OfficeHours OfficeHours
+	// PollJitter randomizes each interval by up to the given ratio of it
+	// in both directions, e.g. 0.1 for ±10%.
+	PollJitter float64
+	// AdaptivePolling changes the interval according to outcomes, optional.
+	AdaptivePolling *AdaptivePolling
+	// ErrorBackoff slows polling down while polls keep failing.
+	ErrorBackoff ErrorBackoff
+	// Watches are checked along with the profile given by the Citizenship
+	// and other options, each with its own schedule and recipients.
+	Watches []Watch
+	// Workers bounds the number of concurrent runs, defaults to the DefaultWorkers.
+	Workers int
+	// MaxRunsPerMinute caps the number of runs against the ABH/LEA site
+	// started within a minute across all of the profiles, unlimited if zero.
+	MaxRunsPerMinute int
+	// Stop makes the Run stop by itself, the Run returns the StoppedError then.
+	Stop StopConditions
+	// OverlapPolicy defines what happens to a run of a profile while
+	// another one is in progress, defaults to the OverlapSkip.
+	OverlapPolicy OverlapPolicy
+	// ReadinessRunWindow is the time, on top of the interval, a successful run
+	// could be late for with the /readyz succeeding, defaults to the
+	// DefaultReadinessRunWindow.
+	ReadinessRunWindow time.Duration
 	// GracefulShutdownTimeout defines duration for the shutting down the server.
 	GracefulShutdownTimeout time.Duration
 	// Port defines the HTTP port of the application.
 	Port int
+	// APIToken is required as the bearer token by the API requests
+	// changing the state, e.g. triggering runs or pausing polling,
+	// such requests are rejected if it's empty.
+	APIToken string
+	// StateDir sets the directory to keep the state between restarts in,
+	// the state is kept only in memory if empty.
+	StateDir string
+
+	// NotifyCooldown is the minimal duration between notifications about
+	// newly available slots, if slots flap in between, they are not notified about.
+	NotifyCooldown time.Duration
+	// SlotsReminderInterval enables reminders with the given interval
+	// while slots stay available.
+	SlotsReminderInterval time.Duration
 
 	// TelegramAPIToken is used to call API of Telegram™.
 	TelegramAPIToken string
 	// TelegramChatID defines the ID of the chat in which messages will be send to.
+	// It's subscribed to the LevelDebug if the DebugFunc is set,
+	// otherwise to the LevelSlots.
 	TelegramChatID int64
-
-	// TODO: comment
+	// TelegramRecipients lists chats, groups, channels and forum topics
+	// to send messages to along with the TelegramChatID.
+	TelegramRecipients []TelegramRecipient
+	// TelegramAdminChatIDs lists chats and users allowed to control
+	// the Runner with the bot commands, defaults to all of the recipients.
+	TelegramAdminChatIDs []int64
+	// TelegramParseMode sets the formatting of messages, either empty
+	// for the plain text, or one of "MarkdownV2", "Markdown", "HTML".
+	TelegramParseMode string
+	// TelegramStatusMessage enables a single pinned status message per
+	// recipient, which is edited after each poll. Notifications about no
+	// slots and occasional errors are not sent then, only slots and
+	// persistent errors are.
+	TelegramStatusMessage bool
+	// TelegramWebhookURL enables receiving the bot updates with a webhook
+	// served by the HTTP server instead of long polling. It's a public https
+	// URL which is proxied to the Port, the DefaultTelegramWebhookPath is
+	// used if the URL has no path.
+	TelegramWebhookURL string
+	// TelegramWebhookSecret is sent by Telegram with each update to
+	// the webhook, a random one is generated on each start if empty.
+	TelegramWebhookSecret string
+	// Escalation re-sends unacknowledged alerts about available slots.
+	Escalation EscalationPolicy
+	// ExecHooks run local commands for notifications along with
+	// the Telegram messages.
+	ExecHooks []ExecHook
+	// MessageTemplates overrides the default text/template templates
+	// of messages per each kind. Templates get the run Result and the Kind,
+	// output of each action is escaped according to the TelegramParseMode
+	// unless it's wrapped into the "raw" function.
+	MessageTemplates map[NotificationKind]string
+
+	// Subscriptions enables everyone to subscribe to slots for their own
+	// profile with the bot, each distinct profile is checked on each poll.
+	Subscriptions bool
+	// SubscribeCitizenships are offered as buttons on the subscription,
+	// defaults to the DefaultSubscribeCitizenships.
+	SubscribeCitizenships []string
+	// MaxSubscribedProfiles caps the number of distinct profiles of
+	// the subscribers, since each one is checked on every poll, defaults
+	// to the DefaultMaxSubscribedProfiles.
+	MaxSubscribedProfiles int
+	// Services are added to the DefaultServices, keys are used in profiles.
+	Services map[string]Service
+
+	// Citizenship, PeopleNumber, LiveInBerlin, FamilyMemberCitizenship,
+	// Reason and Service are values of the checked profile, which is
+	// notified to the recipients. The profile is optional if
+	// Subscriptions are enabled.
 	Citizenship             string
 	PeopleNumber            string
 	LiveInBerlin            string
 	FamilyMemberCitizenship string
 	Reason                  string
+	Service                 string
 
 	Logger *slog.Logger
 }
@@ -86,50 +216,294 @@ func NewRunner(options Options) (*Runner, error) {
 	options = setDefaults(options)
 
 	r := &Runner{
-		logger: options.Logger,
+		logs: newRecentLogs(),
 
 		baseCtx:         options.BaseContext,
 		debugf:          options.DebugFunc,
 		port:            strconv.Itoa(options.Port),
+		apiToken:        options.APIToken,
 		screenshotsPath: options.ScreenshotsPath,
 
+		stateDir:       options.StateDir,
+		notifyCooldown: options.NotifyCooldown,
+		remindInterval: options.SlotsReminderInterval,
+
 		opts:                    options.ChromeAllocatorOptions,
 		runTimeout:              options.ScenarioTimeout,
-		pollInterval:            options.PollInterval,
 		gracefulShutdownTimeout: options.GracefulShutdownTimeout,
+		readinessRunWindow:      options.ReadinessRunWindow,
 
-		citizenship:             options.Citizenship,
-		peopleNumber:            options.PeopleNumber,
-		liveInBerlin:            options.LiveInBerlin,
-		familyMemberCitizenship: options.FamilyMemberCitizenship,
-		reason:                  options.Reason,
+		services:              map[string]Service{},
+		subscriptionsEnabled:  options.Subscriptions,
+		subscribeCitizenships: options.SubscribeCitizenships,
+		maxSubscribedProfiles: options.MaxSubscribedProfiles,
 
 		telegramAPIToken: options.TelegramAPIToken,
-		telegramChatID:   options.TelegramChatID,
+		recipients:       options.TelegramRecipients,
+		escalation:       options.Escalation,
+		adminChatIDs:     options.TelegramAdminChatIDs,
+		statusMessage:    options.TelegramStatusMessage,
+	}
+	r.logger = slog.New(&recentLogsHandler{next: options.Logger.Handler(), logs: r.logs})
+
+	r.officeHours = options.OfficeHours
+	if err := r.officeHours.validate(); err != nil {
+		return nil, err
+	}
+
+	var schedule *Schedule
+	if options.Schedule != nil {
+		schedule = &Schedule{
+			Location: options.Schedule.Location,
+			Windows:  append([]ScheduleWindow(nil), options.Schedule.Windows...),
+		}
+		if err := schedule.compile(r.officeHours); err != nil {
+			return nil, fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+
+	var adaptive *AdaptivePolling
+	if options.AdaptivePolling != nil {
+		a := *options.AdaptivePolling
+		if err := a.validate(); err != nil {
+			return nil, fmt.Errorf("invalid adaptive polling: %w", err)
+		}
+		adaptive = &a
+	}
+	if options.PollJitter < 0 || options.PollJitter >= 1 {
+		return nil, fmt.Errorf("poll jitter should be within [0, 1)")
+	}
+
+	if err := options.ErrorBackoff.validate(); err != nil {
+		return nil, fmt.Errorf("invalid error backoff: %w", err)
+	}
+
+	if err := options.OverlapPolicy.validate(); err != nil {
+		return nil, err
+	}
+	r.runs = newRunLocks(options.OverlapPolicy)
+
+	if options.MaxSubscribedProfiles < 0 {
+		return nil, fmt.Errorf("negative max subscribed profiles")
+	}
+	if options.Workers < 0 || options.MaxRunsPerMinute < 0 {
+		return nil, fmt.Errorf("negative workers or runs per minute")
+	}
+	r.limiter = newRunLimiter(options.Workers, options.MaxRunsPerMinute)
+
+	if err := options.Stop.validate(); err != nil {
+		return nil, fmt.Errorf("invalid stop conditions: %w", err)
+	}
+	r.stopper = &stopper{conditions: options.Stop}
+
+	for key, svc := range DefaultServices {
+		svc.setDefaults()
+		r.services[key] = svc
+	}
+	for key, svc := range options.Services {
+		if err := svc.validate(); err != nil {
+			return nil, fmt.Errorf("invalid service %q: %w", key, err)
+		}
+		svc.setDefaults()
+		r.services[key] = svc
+	}
+
+	watches := options.Watches
+	if options.Citizenship != "" {
+		watches = append([]Watch{{
+			Name: DefaultWatchName,
+			Profile: Profile{
+				Citizenship:             options.Citizenship,
+				PeopleNumber:            options.PeopleNumber,
+				LiveInBerlin:            options.LiveInBerlin,
+				FamilyMemberCitizenship: options.FamilyMemberCitizenship,
+				Reason:                  options.Reason,
+				Service:                 options.Service,
+			},
+		}}, watches...)
+	}
+	if len(watches) == 0 && !r.subscriptionsEnabled {
+		return nil, fmt.Errorf("neither a profile was given nor subscriptions are enabled")
+	}
+
+	if options.TelegramChatID != 0 {
+		level := LevelSlots
+		if options.DebugFunc != nil {
+			level = LevelDebug
+		}
+		r.recipients = append([]TelegramRecipient{{ChatID: options.TelegramChatID, Level: level}}, r.recipients...)
+	}
+	if err := validateRecipients(r.recipients); err != nil {
+		return nil, err
+	}
+
+	templates, err := newMessageTemplates(options.TelegramParseMode, options.MessageTemplates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init message templates: %w", err)
+	}
+	r.templates = templates
+
+	if err := r.loadState(); err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	if r.outbox, err = newOutbox(r.stateDir); err != nil {
+		return nil, fmt.Errorf("failed to load outbox: %w", err)
+	}
+
+	if r.subs, err = newSubscriptions(r.stateDir); err != nil {
+		return nil, fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+
+	var hooks []notifier
+	for _, hook := range options.ExecHooks {
+		if err := hook.validate(); err != nil {
+			return nil, fmt.Errorf("invalid exec hook %q: %w", hook.Name, err)
+		}
+		if hook.Timeout == 0 {
+			hook.Timeout = DefaultExecHookTimeout
+		}
+		n := &execNotifier{hook: hook, logger: r.logger}
+		for _, h := range hooks {
+			if h.id() == n.id() {
+				return nil, fmt.Errorf("duplicated exec hook %q", hook.Name)
+			}
+		}
+		hooks = append(hooks, n)
+	}
+
+	// the default recipients and the exec hooks are registered first,
+	// they get notifications of the subscriptions watch
+	for _, rc := range r.recipients {
+		r.register(&telegramNotifier{r: r, to: rc})
+	}
+	for _, n := range hooks {
+		r.register(n)
+	}
+
+	names := map[string]bool{}
+	for _, wo := range watches {
+		if err := wo.validate(); err != nil {
+			return nil, fmt.Errorf("invalid watch %q: %w", wo.Name, err)
+		}
+		if names[wo.Name] {
+			return nil, fmt.Errorf("duplicated watch %q", wo.Name)
+		}
+		names[wo.Name] = true
+
+		if wo.Profile.Service == "" {
+			wo.Profile.Service = DefaultService
+		}
+		if _, ok := r.services[wo.Profile.Service]; !ok {
+			return nil, fmt.Errorf("watch %q: unknown service %q", wo.Name, wo.Profile.Service)
+		}
+
+		recipients := wo.TelegramRecipients
+		if len(recipients) == 0 {
+			recipients = r.recipients
+		} else {
+			recipients = append([]TelegramRecipient(nil), recipients...)
+			if err := validateRecipients(recipients); err != nil {
+				return nil, fmt.Errorf("watch %q: %w", wo.Name, err)
+			}
+		}
+		if len(recipients) == 0 {
+			return nil, fmt.Errorf("watch %q: no telegram recipients were given", wo.Name)
+		}
+
+		interval, watchSchedule := options.PollInterval, schedule
+		if wo.PollInterval > 0 {
+			interval = wo.PollInterval
+		}
+		if wo.Schedule != nil {
+			watchSchedule = &Schedule{
+				Location: wo.Schedule.Location,
+				Windows:  append([]ScheduleWindow(nil), wo.Schedule.Windows...),
+			}
+			if err := watchSchedule.compile(r.officeHours); err != nil {
+				return nil, fmt.Errorf("watch %q: invalid schedule: %w", wo.Name, err)
+			}
+		}
+
+		profile := wo.Profile
+		w := &watch{
+			name:    wo.Name,
+			profile: &profile,
+			sched:   newScheduler(wo.Name, interval, watchSchedule, adaptive, options.PollJitter, options.ErrorBackoff),
+		}
+		for _, rc := range recipients {
+			w.targets = append(w.targets, r.register(&telegramNotifier{r: r, to: rc}))
+		}
+		w.targets = append(w.targets, hooks...)
+
+		r.watches = append(r.watches, w)
+	}
+
+	if r.subscriptionsEnabled {
+		r.watches = append(r.watches, &watch{
+			name:  subscriptionsWatchName,
+			sched: newScheduler(subscriptionsWatchName, options.PollInterval, schedule, adaptive, options.PollJitter, options.ErrorBackoff),
+		})
+	}
+	r.restoreSchedulers()
+
+	if options.TelegramWebhookURL != "" {
+		if r.webhookURL, err = parseWebhookURL(options.TelegramWebhookURL); err != nil {
+			return nil, err
+		}
+		if err := r.validateWebhookPath(r.webhookURL.Path); err != nil {
+			return nil, err
+		}
+
+		r.webhookSecret = options.TelegramWebhookSecret
+		if r.webhookSecret == "" {
+			r.webhookSecret = newWebhookSecret()
+		} else if !validWebhookSecret(r.webhookSecret) {
+			return nil, fmt.Errorf("webhook secret should be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+		}
+	}
+
+	if len(r.adminChatIDs) == 0 {
+		for _, n := range r.notifiers {
+			if tn, ok := n.(*telegramNotifier); ok && !tn.escalationOnly {
+				r.adminChatIDs = append(r.adminChatIDs, tn.to.ChatID)
+			}
+		}
+	}
+
+	if err := r.escalation.validate(); err != nil {
+		return nil, fmt.Errorf("invalid escalation policy: %w", err)
+	}
+	for _, step := range r.escalation.Steps {
+		for _, rc := range step.Recipients {
+			r.register(&telegramNotifier{r: r, to: rc, escalationOnly: true})
+		}
 	}
 
 	api, err := tgbotapi.NewBotAPI(r.telegramAPIToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct telegram bot API: %w", err)
 	}
+	api.Client = &http.Client{Timeout: telegramRequestTimeout}
 	r.botClient = api
 
 	return r, nil
 }
 
-var ran uint32
-
 // Run starts the server with runnable poller and metric for debug purposes.
 func (r *Runner) Run(ctx context.Context) error {
-	if old := atomic.SwapUint32(&ran, 1); old != 0 {
+	if !r.running.CompareAndSwap(false, true) {
 		return fmt.Errorf("runner is already running")
 	}
-	defer atomic.StoreUint32(&ran, 0)
+	defer r.running.Store(false)
+	r.startedAt = time.Now()
 
 	server := &http.Server{
 		Addr:    ":" + r.port,
-		Handler: r.setupMetricsHandler(),
+		Handler: r.setupHandler(),
 	}
+	// event streams never end on their own
+	server.RegisterOnShutdown(r.events.closeAll)
 
 	var err error
 	go func() {
@@ -140,11 +514,39 @@ func (r *Runner) Run(ctx context.Context) error {
 	}()
 	r.logger.InfoCtx(ctx, "server started...", "addr", server.Addr)
 
-	go r.poll(ctx)
+	// polling stops either by the context, or by the stop conditions
+	pollCtx, stopPolling := context.WithCancel(ctx)
+	defer stopPolling()
+	r.stopper.start(stopPolling)
 
-	<-ctx.Done()
+	delivered := make(chan struct{})
+	go func() {
+		r.deliver(pollCtx)
+		close(delivered)
+	}()
+	r.pollAll(pollCtx)
+	go r.awaitDeadline(pollCtx)
+	if len(r.escalation.Steps) > 0 {
+		go r.escalate(pollCtx)
+	}
+
+	r.registerCommands()
+	r.receiveUpdates(pollCtx)
+
+	<-pollCtx.Done()
 	r.logger.Warn("shutting down the server...")
 
+	stopped := r.stopper.stopped()
+	if stopped != nil {
+		// the final notification is delivered before the exit
+		<-delivered
+		deliverCtx, cancel := context.WithTimeout(context.Background(), r.gracefulShutdownTimeout)
+		if err := r.DeliverPending(deliverCtx); err != nil {
+			r.logger.Error("failed to deliver notifications", "error", err)
+		}
+		cancel()
+	}
+
 	ctxShutDown, cancel := context.WithTimeout(context.Background(), r.gracefulShutdownTimeout)
 	defer func() {
 		cancel()
@@ -161,52 +563,76 @@ func (r *Runner) Run(ctx context.Context) error {
 	if errors.Is(err, http.ErrServerClosed) {
 		err = nil
 	}
+	if err == nil {
+		err = stopped
+	}
 
 	return err
 }
 
-func (r *Runner) poll(ctx context.Context) {
-	timer := time.NewTicker(r.pollInterval)
-
-	r.RunFullCycle()
+// SendMessage sends a given payload to all of the Telegram recipients.
+func (r *Runner) SendMessage(payload string) error {
+	var errs []error
+	for _, rc := range r.recipients {
+		errs = append(errs, r.sendMessage(rc, payload, nil))
+	}
 
-	for {
-		select {
-		case <-timer.C:
-			r.RunFullCycle()
+	return errors.Join(errs...)
+}
 
-		case <-ctx.Done():
-			timer.Stop()
-			return
-		}
+// SendPhoto sends a given JPEG image to all of the Telegram recipients with
+// the payload as its caption. If the payload does not fit into
+// a caption, it's sent as a separate message after the image.
+func (r *Runner) SendPhoto(payload string, photo []byte) error {
+	var errs []error
+	for _, rc := range r.recipients {
+		errs = append(errs, r.sendPhoto(rc, payload, photo, nil))
 	}
+
+	return errors.Join(errs...)
 }
 
-// SendMessage sends a given payload to the Telegram chat.
-func (r *Runner) SendMessage(payload string) error {
-	msgcfg := tgbotapi.NewMessage(r.telegramChatID, payload)
-	msgcfg.AllowSendingWithoutReply = true
-	msgcfg.DisableWebPagePreview = true
+// RunOnce runs the full cycle through the ABH/LEA site and
+// returns the URI to continue booking the appointment.
+func (r *Runner) RunOnce() (uri string, found bool, _ error) {
+	p, ok := r.configuredProfile()
+	if !ok {
+		return "", false, fmt.Errorf("no profile is configured")
+	}
+
+	ctx, release, ok := r.runs.acquire(r.baseCtx, p)
+	if !ok {
+		return "", false, fmt.Errorf("another run of the profile is in progress")
+	}
+	defer release()
 
-	_, err := r.botClient.Send(msgcfg)
+	free, err := r.limiter.acquire(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to send message to telegram chat: %w", err)
+		return "", false, err
 	}
+	defer free()
 
-	return nil
+	uri, found, _, err = r.runScenario(ctx, p)
+	return uri, found, err
 }
 
-// RunOnce runs the full cycle through the ABH/LEA site and
-// returns the URI to continue booking the appointment.
-func (r *Runner) RunOnce() (uri string, found bool, _ error) {
-	ctx, cancel := chromedp.NewExecAllocator(r.baseCtx, r.opts...)
+// runScenario does the same as RunOnce for the given profile
+// and also returns the screenshot of the final page.
+func (r *Runner) runScenario(ctx context.Context, p Profile) (uri string, found bool, screenshot []byte, _ error) {
+	service, ok := r.services[p.Service]
+	if !ok {
+		return "", false, nil, fmt.Errorf("unknown service %q", p.Service)
+	}
+
+	ctx, cancel := chromedp.NewExecAllocator(ctx, r.opts...)
 	defer cancel() // allocator
 
 	ctx, cancel = chromedp.NewContext(ctx, chromedp.WithDebugf(r.debugf))
 	defer cancel() // new tab
+	tabCtx := ctx
 
 	if err := chromedp.Run(ctx); err != nil {
-		return "", false, fmt.Errorf("initial run failed: %w", err)
+		return "", false, nil, fmt.Errorf("initial run failed: %w", err)
 	}
 
 	ctx, cancel = context.WithTimeout(ctx, r.runTimeout)
@@ -236,30 +662,30 @@ func (r *Runner) RunOnce() (uri string, found bool, _ error) {
 		chromedp.Sleep(time.Millisecond * 250),
 	}
 
-	czSteps := getOptionsSteps("select citizenship", `//*[@id="xi-sel-400"]`, r.citizenship, `//*[@id="xi-sel-422"]`)
+	czSteps := getOptionsSteps("select citizenship", `//*[@id="xi-sel-400"]`, p.Citizenship, `//*[@id="xi-sel-422"]`)
 
-	applicantsNumberSteps := getOptionsSteps("select applicants num", `//*[@id="xi-sel-422"]`, r.peopleNumber, `//*[@id="xi-sel-427"]`)
+	applicantsNumberSteps := getOptionsSteps("select applicants num", `//*[@id="xi-sel-422"]`, p.PeopleNumber, `//*[@id="xi-sel-427"]`)
 
-	liveInBerlinSteps := getOptionsSteps("live in berlin", `//*[@id="xi-sel-427"]`, r.liveInBerlin, `//*[@id="xi-sel-428"]`)
+	liveInBerlinSteps := getOptionsSteps("live in berlin", `//*[@id="xi-sel-427"]`, p.LiveInBerlin, `//*[@id="xi-sel-428"]`)
 
 	var memberCZSteps []chromedp.Action
-	if r.familyMemberCitizenship != "" {
-		memberCZSteps = getOptionsSteps("select family member citizenship", `//*[@id="xi-sel-428"]`, r.familyMemberCitizenship, `//*[@id="xi-div-30"]`)
+	if p.FamilyMemberCitizenship != "" {
+		memberCZSteps = getOptionsSteps("select family member citizenship", `//*[@id="xi-sel-428"]`, p.FamilyMemberCitizenship, `//*[@id="xi-div-30"]`)
 	}
 
 	postSteps := []chromedp.Action{
-		// click on apply for a residence permit...
-		// TODO: apply or extend
-		chromedp.Click(`//*[@id="xi-div-30"]/div[1]`, chromedp.BySearch),
+		// click on the application, e.g. apply for a residence permit...
+		chromedp.WaitVisible(service.ApplicationSelector, chromedp.BySearch),
+		chromedp.Click(service.ApplicationSelector, chromedp.BySearch),
 		chromedp.Sleep(time.Millisecond * 250),
-		// ... wait for reasons for residance permit...
-		chromedp.WaitVisible(`//*[@id="inner-160-0-1"]`, chromedp.BySearch),
+		// ... wait for the categories, e.g. reasons for residance permit...
+		chromedp.WaitVisible(service.CategoriesSelector, chromedp.BySearch),
 		chromedp.Sleep(time.Millisecond * 250),
-		// ... click economic activity...
-		chromedp.Click(`//*[@id="inner-160-0-1"]/div/div[3]`, chromedp.BySearch),
+		// ... click the category, e.g. economic activity...
+		chromedp.Click(service.CategorySelector, chromedp.BySearch),
 		chromedp.Sleep(time.Millisecond * 250),
-		// ... click blaukarte...
-		chromedp.Click(`//*[@id="SERVICEWAHL_EN160-0-1-1-324659"]`, chromedp.BySearch),
+		// ... click the service, e.g. blaukarte...
+		chromedp.Click(service.ServiceSelector, chromedp.BySearch),
 		chromedp.Sleep(time.Millisecond * 250),
 		// ... wait until Next button...
 		chromedp.WaitVisible(`//*[@id="applicationForm:managedForm"]/div[5]`, chromedp.BySearch),
@@ -272,18 +698,19 @@ func (r *Runner) RunOnce() (uri string, found bool, _ error) {
 		chromedp.WaitNotVisible(`body > div.loading`, chromedp.ByQuery),
 	}
 
-	var screenshotStep []chromedp.Action
+	// the screenshot is always taken to be sent along with notifications
+	var buf []byte
+	screenshotStep := []chromedp.Action{
+		chromedp.FullScreenshot(&buf, 90),
+	}
 	if r.screenshotsPath != "" {
-		var buf []byte
-
 		screenShotFile := filepath.Join(r.screenshotsPath, fmt.Sprintf("screenshot_at_%s.jpg", time.Now().Format(time.DateTime)))
 
-		screenshotStep = []chromedp.Action{
-			chromedp.FullScreenshot(&buf, 90),
+		screenshotStep = append(screenshotStep,
 			chromedp.ActionFunc(func(ctx context.Context) error {
 				return os.WriteFile(screenShotFile, buf, 0o644)
 			}),
-		}
+		)
 	}
 
 	var nodes []*cdp.Node
@@ -293,18 +720,26 @@ func (r *Runner) RunOnce() (uri string, found bool, _ error) {
 	}
 
 	var summurySteps []chromedp.Action
-	for _, stepsSlice := range [][]chromedp.Action{
-		preSteps,
-		czSteps,
-		applicantsNumberSteps,
-		liveInBerlinSteps,
-		memberCZSteps,
-		postSteps,
-		checkMessagesBoxElem,
-		screenshotStep,
+	for _, stepsSlice := range []struct {
+		name    string
+		actions []chromedp.Action
+	}{
+		{"start page", preSteps},
+		{"citizenship", czSteps},
+		{"applicants number", applicantsNumberSteps},
+		{"live in berlin", liveInBerlinSteps},
+		{"family member citizenship", memberCZSteps},
+		{"service", postSteps},
+		{"messages box", checkMessagesBoxElem},
+		{"screenshot", screenshotStep},
 	} {
-		if len(stepsSlice) > 0 {
-			summurySteps = append(summurySteps, stepsSlice...)
+		if len(stepsSlice.actions) > 0 {
+			name := stepsSlice.name
+			summurySteps = append(summurySteps, stepsSlice.actions...)
+			summurySteps = append(summurySteps, chromedp.ActionFunc(func(context.Context) error {
+				r.events.publish(eventStepCompleted, map[string]any{"profile": p, "step": name})
+				return nil
+			}))
 		}
 	}
 
@@ -312,56 +747,212 @@ func (r *Runner) RunOnce() (uri string, found bool, _ error) {
 	summurySteps = append(summurySteps, chromedp.Location(&u))
 
 	if err := chromedp.Run(ctx, summurySteps...); err != nil {
-		return "", false, fmt.Errorf("failed to run chrome: %w", err)
+		// the page the run has failed on helps to find out why
+		return "", false, r.failureScreenshot(tabCtx), fmt.Errorf("failed to run chrome: %w", err)
+	}
+
+	return u, len(nodes) == 0, buf, nil
+}
+
+// failureScreenshotTimeout limits taking the screenshot after a failed run.
+const failureScreenshotTimeout = time.Second * 5
+
+// failureScreenshot takes the screenshot of the page in the tab after
+// a failed run, it returns nil if the tab is gone.
+func (r *Runner) failureScreenshot(tabCtx context.Context) []byte {
+	ctx, cancel := context.WithTimeout(tabCtx, failureScreenshotTimeout)
+	defer cancel()
+
+	var buf []byte
+	if err := chromedp.Run(ctx, chromedp.FullScreenshot(&buf, 90)); err != nil {
+		r.logger.Debug("failed to take the failure screenshot", "error", err)
+		return nil
+	}
+
+	if r.screenshotsPath != "" {
+		file := filepath.Join(r.screenshotsPath, fmt.Sprintf("failure_at_%s.jpg", time.Now().Format(time.DateTime)))
+		if err := os.WriteFile(file, buf, 0o644); err != nil {
+			r.logger.Error("failed to save the failure screenshot", "error", err)
+		}
 	}
 
-	return u, len(nodes) == 0, nil
+	return buf
 }
 
 // RunFullCycle is used mostly as one-liner, it consists of
 // running the Runner.RunOnce() and
-// the most simple retries while sending message to Telegram.
+// queueing notifications about the result, which are delivered
+// by the Runner.Run() or the Runner.DeliverPending().
 func (r *Runner) RunFullCycle() {
-	now := time.Now()
-	r.logger.Debug("new poll cycle")
-	continueURI, successfull, err := r.RunOnce()
+	for _, w := range r.watches {
+		r.runCycle(w)
+	}
+}
+
+// runCycle checks the profiles of the watch.
+func (r *Runner) runCycle(w *watch) []Result {
+	w.sched.started(time.Now())
+
+	return r.cycle(w)
+}
+
+// cycle is the runCycle which has been already started in the scheduler,
+// results of skipped runs are left out.
+func (r *Runner) cycle(w *watch) []Result {
+	r.logger.Debug("new poll cycle", "watch", w.name)
+
+	var results []Result
+	for _, p := range r.profiles(w) {
+		if res, ok := r.checkProfile(p); ok {
+			results = append(results, res)
+		}
+	}
+
+	if kind, failures := w.sched.finished(results); kind != "" {
+		r.notifyBreaker(w, kind, failures, results)
+		r.stateChanged(w, string(kind))
+	}
+	r.saveSchedulers()
+	r.checkStop(w, results)
+	if r.statusMessage {
+		r.updateStatusMessages()
+	}
+	r.logger.Debug("poll ended", "watch", w.name, "profiles", len(results))
+
+	return results
+}
+
+// checkProfile checks the profile once and notifies about the result,
+// it returns false if the run has been skipped or cancelled according
+// to the overlap policy.
+func (r *Runner) checkProfile(p Profile) (Result, bool) {
+	l := r.logger.With("citizenship", p.Citizenship, "service", p.Service)
+
+	ctx, release, ok := r.runs.acquire(r.baseCtx, p)
+	if !ok {
+		l.Warn("skipped the run, another one is in progress", "policy", r.runs.policy)
+		return Result{}, false
+	}
+	free, err := r.limiter.acquire(ctx)
 	if err != nil {
-		r.logger.Error("failed to check", "error", err)
-		return
+		// cancelled or shutting down while waiting for a worker
+		release()
+		skippedRunsTotal.Inc()
+		return Result{}, false
+	}
+	r.events.publish(eventRunStarted, map[string]any{"profile": p})
+	res := r.check(ctx, p)
+	free()
+	r.artifacts.add(res)
+	r.publishOutcome(res)
+	if res.Error != "" {
+		r.events.publish(eventError, map[string]any{"profile": p, "error": res.Error})
+	}
+	cancelled := ctx.Err() != nil && r.baseCtx.Err() == nil
+	release()
+
+	if cancelled {
+		l.Warn("cancelled the run in favor of a new one")
+		skippedRunsTotal.Inc()
+		return Result{}, false
 	}
-	r.logger.Debug("fetched one run", "elapsed sec", time.Since(now).Seconds())
 
-	scenariosTotal.Inc()
-	if successfull {
-		successScenariosTotal.Inc()
+	if res.Error != "" {
+		l.Error("failed to check", "error", res.Error)
+	} else {
+		l.Debug("fetched one run", "elapsed sec", res.Duration.Seconds())
+
+		scenariosTotal.Inc()
+		if res.SlotsAvailable {
+			successScenariosTotal.Inc()
+		}
 	}
 
-	if !successfull && r.debugf == nil {
-		r.logger.Info("checked, no available slots")
-		return
+	if res.Error == "" && !res.SlotsAvailable {
+		l.Info("checked, no available slots")
 	}
 
-	text := "Slots are available!\n"
-	if !successfull {
-		text = "No slots are available\n"
+	r.stateMu.Lock()
+	st := r.notifyState(p)
+	changedAt := st.ChangedAt
+	kind, notify := st.transit(res, r.notifyCooldown, r.remindInterval)
+	if kind != KindSlotsGone {
+		changedAt = st.ChangedAt
 	}
-	text += fmt.Sprintf("Proceed further: %s", continueURI)
 
-	// 1sec retry code block
-	for i := 0; i < 5; i++ {
-		if err := r.SendMessage(text); err != nil {
-			r.logger.Error("failed to send message to telegram", "error", err)
-			time.Sleep(1 * time.Second)
-			continue
+	errStreak := st.Errors
+
+	data := messageData{Result: res, Kind: kind, AvailableSince: changedAt}
+	switch {
+	case kind == KindSlots && len(r.escalation.Steps) > 0:
+		data.AlertID = r.raiseAlert(data)
+	case kind == KindSlotsGone:
+		// no reason to escalate anymore
+		r.closeAlerts(p)
+	}
+	r.saveState()
+	r.stateMu.Unlock()
+
+	if notify {
+		targets := r.targets(p)
+		if r.quiet(kind, errStreak) {
+			// the status message shows it instead
+			targets = withoutTelegram(targets)
 		}
-		break
+		r.notify(data, targets)
+	} else {
+		l.Debug("nothing to notify about")
 	}
-	r.logger.Debug("poll ended")
+	if kind == KindError && errStreak == persistentErrorStreak {
+		r.notifySubscriptionFailing(data, errStreak)
+	}
+
+	return res, true
 }
 
-func (r *Runner) setupMetricsHandler() http.Handler {
+// check runs the scenario once and describes its result.
+func (r *Runner) check(ctx context.Context, p Profile) Result {
+	res := Result{
+		Profile:   p,
+		StartedAt: time.Now(),
+	}
+
+	uri, found, screenshot, err := r.runScenario(ctx, p)
+	res.Duration = time.Since(res.StartedAt)
+	res.URL, res.SlotsAvailable, res.Screenshot = uri, found, screenshot
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+func (r *Runner) setupHandler() http.Handler {
+	mux := r.routes()
+	if r.webhookURL != nil {
+		mux.HandleFunc(r.webhookURL.Path, r.handleWebhook)
+	}
+
+	return mux
+}
+
+// routes returns the mux of the routes served along with the webhook.
+func (r *Runner) routes() *http.ServeMux {
 	mux := http.NewServeMux()
-	http.NewServeMux().Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/api/v1/alerts/", r.requireToken(r.handleAlertAck))
+	mux.HandleFunc("/api/v1/runs", r.requireToken(r.handleRuns))
+	mux.HandleFunc("/api/v1/runs/latest", r.handleLatestRun)
+	mux.HandleFunc("/api/v1/status", r.handleStatus)
+	mux.HandleFunc("/healthz", r.handleHealthz)
+	mux.HandleFunc("/readyz", r.handleReadyz)
+	mux.HandleFunc("/api/v1/pause", r.requireToken(r.handlePause))
+	mux.HandleFunc("/api/v1/resume", r.requireToken(r.handlePause))
+	mux.HandleFunc("/api/v1/artifacts", r.handleArtifacts)
+	mux.HandleFunc("/api/v1/artifacts/", r.handleArtifact)
+	mux.HandleFunc("/api/v1/events", r.handleEvents)
+	mux.Handle("/dashboard/", http.StripPrefix("/dashboard/", dashboardHandler()))
+	mux.HandleFunc("/", handleRoot)
 
 	return mux
 }
@@ -375,6 +966,16 @@ const (
 	DefaultScenarioTimeout         = time.Second * 50
 	DefaultGracefulShutdownTimeout = time.Second * 15
 	DefaultHTTPPort                = 80
+	DefaultExecHookTimeout         = time.Second * 30
+	DefaultWorkers                 = 2
+	DefaultReadinessRunWindow      = time.Hour
+	DefaultErrorBackoffMax         = time.Minute * 30
+	DefaultBreakerThreshold        = 5
+	DefaultBreakerProbeInterval    = time.Minute * 15
+	DefaultMaxSubscribedProfiles   = 10
+
+	maxCaptionLength       = 1024
+	telegramRequestTimeout = time.Second * 30
 )
 
 func setDefaults(options Options) Options {
@@ -395,6 +996,8 @@ func setDefaults(options Options) Options {
 		options.ChromeAllocatorOptions = append(requiredOptions, options.ChromeAllocatorOptions...)
 	}
 
+	options.OfficeHours.setDefaults()
+
 	if options.ScenarioTimeout == 0 ||
 		options.ScenarioTimeout < time.Second*30 {
 		options.ScenarioTimeout = DefaultScenarioTimeout
@@ -416,6 +1019,39 @@ func setDefaults(options Options) Options {
 		options.PollInterval = DefaultPollInterval
 	}
 
+	if options.ReadinessRunWindow == 0 {
+		options.ReadinessRunWindow = DefaultReadinessRunWindow
+	}
+
+	if options.Workers == 0 {
+		options.Workers = DefaultWorkers
+	}
+
+	if options.OverlapPolicy == "" {
+		options.OverlapPolicy = OverlapSkip
+	}
+
+	if options.ErrorBackoff.MaxInterval == 0 {
+		options.ErrorBackoff.MaxInterval = DefaultErrorBackoffMax
+	}
+	if options.ErrorBackoff.BreakerThreshold == 0 {
+		options.ErrorBackoff.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if options.ErrorBackoff.ProbeInterval == 0 {
+		options.ErrorBackoff.ProbeInterval = DefaultBreakerProbeInterval
+	}
+
+	if options.Service == "" {
+		options.Service = DefaultService
+	}
+
+	if len(options.SubscribeCitizenships) == 0 {
+		options.SubscribeCitizenships = DefaultSubscribeCitizenships
+	}
+	if options.MaxSubscribedProfiles == 0 {
+		options.MaxSubscribedProfiles = DefaultMaxSubscribedProfiles
+	}
+
 	if options.Logger == nil {
 		options.Logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 	}
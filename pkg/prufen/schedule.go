@@ -0,0 +1,306 @@
+package prufen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// the default location should be available without the system tzdata
+	_ "time/tzdata"
+)
+
+// DefaultScheduleLocation is the location schedule windows are evaluated in.
+const DefaultScheduleLocation = "Europe/Berlin"
+
+// scheduleHorizon is the farthest the next run is looked up for.
+const scheduleHorizon = time.Hour * 24 * 8
+
+type (
+	// Schedule changes the poll interval within time windows,
+	// the PollInterval applies outside of them.
+	Schedule struct {
+		// Location is the time zone of the windows,
+		// defaults to the DefaultScheduleLocation.
+		Location *time.Location
+		// Windows are matched in order, the first active one applies.
+		Windows []ScheduleWindow
+
+		// officeHours are used by the OffHours windows.
+		officeHours OfficeHours
+	}
+
+	// ScheduleWindow is either a cron expression, or a time of day range on
+	// weekdays, which is active while the current minute matches it.
+	ScheduleWindow struct {
+		// Cron is a standard 5 fields expression "minute hour day month weekday",
+		// e.g. "* 7-8 * * 1-5" is active on weekdays from 07:00 to 09:00.
+		// Weekdays, From and To are ignored if it's set.
+		Cron string
+		// Weekdays the window is active on, every day if empty.
+		Weekdays []time.Weekday
+		// From and To are times of day since midnight, the window wraps
+		// over midnight if To is before From. The whole day if both are zero.
+		From, To time.Duration
+		// Interval is the poll interval within the window.
+		Interval time.Duration
+		// Paused disables polling within the window.
+		Paused bool
+		// Holidays restricts the window to the Berlin public holidays.
+		Holidays bool
+		// OffHours restricts the window to the time the office is closed,
+		// that is out of the office hours, on weekends and holidays.
+		OffHours bool
+
+		cron *cronExpr
+	}
+
+	// cronExpr is a parsed cron expression, each field is a set of values.
+	cronExpr struct {
+		minute, hour, dom, month, dow [64]bool
+		// domAny and dowAny are set if the fields are "*", the day matches
+		// either of them otherwise, just like cron does.
+		domAny, dowAny bool
+	}
+)
+
+// compile validates the schedule and parses the cron expressions,
+// the office hours are used by the OffHours windows.
+func (s *Schedule) compile(hours OfficeHours) error {
+	s.officeHours = hours
+
+	if s.Location == nil {
+		loc, err := time.LoadLocation(DefaultScheduleLocation)
+		if err != nil {
+			return fmt.Errorf("failed to load location: %w", err)
+		}
+		s.Location = loc
+	}
+
+	for i := range s.Windows {
+		w := &s.Windows[i]
+		if !w.Paused && w.Interval <= 0 {
+			return fmt.Errorf("window #%d: non-positive interval %s", i, w.Interval)
+		}
+
+		if w.Cron != "" {
+			expr, err := parseCron(w.Cron)
+			if err != nil {
+				return fmt.Errorf("window #%d: %w", i, err)
+			}
+			w.cron = expr
+			continue
+		}
+
+		if w.From < 0 || w.From >= time.Hour*24 || w.To < 0 || w.To > time.Hour*24 {
+			return fmt.Errorf("window #%d: times of day should be within a day", i)
+		}
+	}
+
+	return nil
+}
+
+// active reports whether the window is active at the time.
+func (w ScheduleWindow) active(t time.Time, hours OfficeHours) bool {
+	if w.Holidays {
+		if _, ok := berlinHoliday(t); !ok {
+			return false
+		}
+	}
+	if w.OffHours && hours.open(t) {
+		return false
+	}
+
+	if w.cron != nil {
+		return w.cron.matches(t)
+	}
+
+	if len(w.Weekdays) > 0 {
+		found := false
+		for _, wd := range w.Weekdays {
+			found = found || wd == t.Weekday()
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if w.From == 0 && (w.To == 0 || w.To == time.Hour*24) {
+		return true
+	}
+
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.From <= w.To {
+		return tod >= w.From && tod < w.To
+	}
+
+	return tod >= w.From || tod < w.To
+}
+
+// intervalAt returns the poll interval at the time, zero if polling is paused.
+func (s *Schedule) intervalAt(t time.Time, def time.Duration) time.Duration {
+	if s == nil {
+		return def
+	}
+
+	t = t.In(s.Location)
+	for _, w := range s.Windows {
+		if !w.active(t, s.officeHours) {
+			continue
+		}
+		if w.Paused {
+			return 0
+		}
+		return w.Interval
+	}
+
+	return def
+}
+
+// activeSince returns the minute polling has been switched on since by the
+// schedule, looking back for the limit at most. The zero time is returned
+// if it has been on for longer.
+func (s *Schedule) activeSince(now time.Time, limit time.Duration) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	for m := now.Truncate(time.Minute); now.Sub(m) <= limit; m = m.Add(-time.Minute) {
+		if s.intervalAt(m, time.Minute) == 0 {
+			return m.Add(time.Minute)
+		}
+	}
+
+	return time.Time{}
+}
+
+// next returns the time of the next run after the last one at the given time,
+// it's the first moment the interval of the schedule, adjusted by the given
+// function, has elapsed since then. The zero time is returned if there is
+// no run within the horizon.
+func (s *Schedule) next(last, now time.Time, def time.Duration, adjust func(time.Duration) time.Duration) time.Time {
+	if s == nil || len(s.Windows) == 0 {
+		if last.IsZero() {
+			return now
+		}
+		return last.Add(adjust(def))
+	}
+
+	from := last
+	if from.IsZero() {
+		from = now
+	}
+
+	// windows are evaluated per minute, hence the interval is the same
+	// within each minute
+	for m := from.Truncate(time.Minute); m.Sub(from) < scheduleHorizon; m = m.Add(time.Minute) {
+		iv := s.intervalAt(m, def)
+		if iv == 0 {
+			continue
+		}
+
+		at := last.Add(adjust(iv))
+		if last.IsZero() {
+			at = now
+		}
+		if at.Before(m) {
+			// the faster window has just started
+			at = m
+		}
+		if at.Before(m.Add(time.Minute)) {
+			return at
+		}
+	}
+
+	return time.Time{}
+}
+
+// parseCron parses a standard 5 fields cron expression.
+func parseCron(expr string) (*cronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q should have 5 fields", expr)
+	}
+
+	c := &cronExpr{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	for i, f := range []struct {
+		set          *[64]bool
+		lower, upper int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	} {
+		if err := parseCronField(fields[i], f.lower, f.upper, f.set); err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+	}
+	// both 0 and 7 are Sunday
+	c.dow[0] = c.dow[0] || c.dow[7]
+
+	return c, nil
+}
+
+// parseCronField parses a comma separated list of "*", values, ranges,
+// each with an optional step, into the set.
+func parseCronField(field string, lower, upper int, set *[64]bool) error {
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		lo, hi := lower, upper
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return fmt.Errorf("invalid value %q", loStr)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return fmt.Errorf("invalid value %q", hiStr)
+				}
+			} else if hasStep {
+				hi = upper
+			}
+		}
+
+		if lo < lower || hi > upper || lo > hi {
+			return fmt.Errorf("%q is out of range %d-%d", part, lower, upper)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+
+	return nil
+}
+
+func (c *cronExpr) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
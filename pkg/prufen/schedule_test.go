@@ -0,0 +1,267 @@
+package prufen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	// 2023-03-06 is Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2023, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		expr    string
+		match   []time.Time
+		noMatch []time.Time
+	}{
+		{
+			expr:  "* * * * *",
+			match: []time.Time{at(6, 0, 0), at(12, 23, 59)},
+		},
+		{
+			expr:    "*/15 * * * *",
+			match:   []time.Time{at(6, 10, 0), at(6, 10, 15), at(6, 10, 45)},
+			noMatch: []time.Time{at(6, 10, 10), at(6, 10, 59)},
+		},
+		{
+			expr:    "10-20/5 * * * *",
+			match:   []time.Time{at(6, 10, 10), at(6, 10, 15), at(6, 10, 20)},
+			noMatch: []time.Time{at(6, 10, 12), at(6, 10, 25)},
+		},
+		{
+			expr:    "5/20 * * * *",
+			match:   []time.Time{at(6, 10, 5), at(6, 10, 25), at(6, 10, 45)},
+			noMatch: []time.Time{at(6, 10, 0), at(6, 10, 20)},
+		},
+		{
+			expr:    "* 7-8,18 * * 1-5",
+			match:   []time.Time{at(6, 7, 0), at(6, 8, 59), at(10, 18, 30)},
+			noMatch: []time.Time{at(6, 9, 0), at(6, 17, 59), at(11, 7, 0)},
+		},
+		{
+			expr:    "* * * * 0",
+			match:   []time.Time{at(5, 12, 0), at(12, 12, 0)},
+			noMatch: []time.Time{at(6, 12, 0), at(11, 12, 0)},
+		},
+		{
+			expr:    "* * * * 7",
+			match:   []time.Time{at(5, 12, 0), at(12, 12, 0)},
+			noMatch: []time.Time{at(6, 12, 0), at(11, 12, 0)},
+		},
+		{
+			expr:    "* * * * 5-7",
+			match:   []time.Time{at(10, 12, 0), at(11, 12, 0), at(12, 12, 0)},
+			noMatch: []time.Time{at(6, 12, 0), at(9, 12, 0)},
+		},
+		{
+			// either the day of month or the day of week, just like cron
+			expr:    "0 9 1,15 * 1",
+			match:   []time.Time{at(1, 9, 0), at(15, 9, 0), at(6, 9, 0), at(13, 9, 0)},
+			noMatch: []time.Time{at(2, 9, 0), at(7, 9, 0), at(6, 10, 0)},
+		},
+		{
+			expr:    "0 9 1 * *",
+			match:   []time.Time{at(1, 9, 0)},
+			noMatch: []time.Time{at(6, 9, 0)},
+		},
+		{
+			expr:    "0 9 * * 1",
+			match:   []time.Time{at(6, 9, 0)},
+			noMatch: []time.Time{at(1, 9, 0)},
+		},
+		{
+			expr:    "* * * 4 *",
+			noMatch: []time.Time{at(6, 9, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range tt.match {
+				if !c.matches(m) {
+					t.Errorf("does not match %s", m.Format("Mon 2006-01-02 15:04"))
+				}
+			}
+			for _, m := range tt.noMatch {
+				if c.matches(m) {
+					t.Errorf("matches %s", m.Format("Mon 2006-01-02 15:04"))
+				}
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"10-5 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeds", expr)
+		}
+	}
+}
+
+func TestScheduleWindowActive(t *testing.T) {
+	// 2023-03-06 is Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2023, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		window   ScheduleWindow
+		active   []time.Time
+		inactive []time.Time
+	}{
+		{
+			name:   "whole day",
+			window: ScheduleWindow{Interval: time.Minute},
+			active: []time.Time{at(6, 0, 0), at(6, 23, 59)},
+		},
+		{
+			name:     "within a day",
+			window:   ScheduleWindow{From: time.Hour * 7, To: time.Hour * 9, Interval: time.Minute},
+			active:   []time.Time{at(6, 7, 0), at(6, 8, 59)},
+			inactive: []time.Time{at(6, 6, 59), at(6, 9, 0)},
+		},
+		{
+			name:     "over midnight",
+			window:   ScheduleWindow{From: time.Hour * 22, To: time.Hour * 6, Interval: time.Minute},
+			active:   []time.Time{at(6, 22, 0), at(6, 23, 59), at(7, 0, 0), at(7, 5, 59)},
+			inactive: []time.Time{at(6, 21, 59), at(7, 6, 0), at(7, 12, 0)},
+		},
+		{
+			name:     "weekdays",
+			window:   ScheduleWindow{Weekdays: []time.Weekday{time.Saturday, time.Sunday}, Interval: time.Minute},
+			active:   []time.Time{at(11, 12, 0), at(12, 12, 0)},
+			inactive: []time.Time{at(6, 12, 0), at(10, 23, 59)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, m := range tt.active {
+				if !tt.window.active(m, OfficeHours{}) {
+					t.Errorf("is not active at %s", m.Format("Mon 15:04"))
+				}
+			}
+			for _, m := range tt.inactive {
+				if tt.window.active(m, OfficeHours{}) {
+					t.Errorf("is active at %s", m.Format("Mon 15:04"))
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// 2023-03-06 is Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2023, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+	same := func(iv time.Duration) time.Duration { return iv }
+
+	tests := []struct {
+		name      string
+		windows   []ScheduleWindow
+		interval  time.Duration
+		last, now time.Time
+		want      time.Time
+	}{
+		{
+			name: "no windows",
+			last: at(6, 12, 0),
+			now:  at(6, 12, 1),
+			want: at(6, 12, 3),
+		},
+		{
+			name: "first run",
+			now:  at(6, 12, 1),
+			want: at(6, 12, 1),
+		},
+		{
+			name:    "within a window",
+			windows: []ScheduleWindow{{From: time.Hour * 7, To: time.Hour * 9, Interval: time.Minute}},
+			last:    at(6, 8, 0),
+			now:     at(6, 8, 0),
+			want:    at(6, 8, 1),
+		},
+		{
+			name:     "faster window starts in the middle of the interval",
+			windows:  []ScheduleWindow{{From: time.Hour * 9, To: time.Hour * 10, Interval: time.Minute * 5}},
+			interval: time.Hour,
+			last:     at(6, 8, 30),
+			now:      at(6, 8, 31),
+			want:     at(6, 9, 0),
+		},
+		{
+			name:    "slower window starts in the middle of the interval",
+			windows: []ScheduleWindow{{From: time.Hour * 9, To: time.Hour * 10, Interval: time.Minute * 30}},
+			last:    at(6, 8, 58),
+			now:     at(6, 8, 59),
+			want:    at(6, 9, 28),
+		},
+		{
+			name:    "paused over midnight",
+			windows: []ScheduleWindow{{From: time.Hour * 22, To: time.Hour * 6, Paused: true}},
+			last:    at(6, 21, 58),
+			now:     at(6, 21, 59),
+			want:    at(7, 6, 0),
+		},
+		{
+			name:    "paused on weekends",
+			windows: []ScheduleWindow{{Weekdays: []time.Weekday{time.Saturday, time.Sunday}, Paused: true}},
+			last:    at(10, 23, 59),
+			now:     at(11, 0, 0),
+			want:    at(13, 0, 0),
+		},
+		{
+			name:    "cron window",
+			windows: []ScheduleWindow{{Cron: "* 7-8 * * 1-5", Interval: time.Minute}, {Paused: true}},
+			last:    at(10, 8, 59),
+			now:     at(10, 9, 0),
+			want:    at(13, 7, 0),
+		},
+		{
+			name:    "always paused",
+			windows: []ScheduleWindow{{Paused: true}},
+			last:    at(6, 12, 0),
+			now:     at(6, 12, 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Schedule{Location: time.UTC, Windows: tt.windows}
+			if err := s.compile(OfficeHours{}); err != nil {
+				t.Fatal(err)
+			}
+
+			interval := tt.interval
+			if interval == 0 {
+				interval = time.Minute * 3
+			}
+			if got := s.next(tt.last, tt.now, interval, same); !got.Equal(tt.want) {
+				t.Errorf("next() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
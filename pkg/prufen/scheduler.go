@@ -0,0 +1,465 @@
+package prufen
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historySize is the number of the last run results kept in memory.
+const historySize = 100
+
+type (
+	// scheduler holds the polling state which could be changed at runtime.
+	scheduler struct {
+		// name is the name of the watch, used in metrics.
+		name     string
+		mu       sync.Mutex
+		paused   bool
+		interval time.Duration
+		// intervalSet is set if the interval has been changed at runtime.
+		intervalSet bool
+		// resumedAt is the time the polling has been resumed at runtime.
+		resumedAt time.Time
+		// schedule changes the interval within time windows, optional.
+		schedule *Schedule
+		// adaptive changes the interval according to outcomes, optional.
+		adaptive *AdaptivePolling
+		// jitter is the max deviation ratio of intervals, jitterFactor
+		// is the random one of the last run.
+		jitter       float64
+		jitterFactor float64
+		// lastOutcome is the outcome of the last run, changedAt is the time
+		// it has changed, or slots were seen, quietSince is the time of
+		// the first outcome.
+		lastOutcome string
+		changedAt   time.Time
+		quietSince  time.Time
+		// backoff slows polling down on failures, breaker is the state
+		// of its circuit breaker.
+		backoff ErrorBackoff
+		breaker breakerState
+
+		lastStart   time.Time
+		lastResults []Result
+		errorStreak int
+		// runs are the last run results without screenshots, the oldest first.
+		runs []Result
+
+		// trigger requests a run out of the schedule.
+		trigger chan checkRequest
+		// changed wakes the poll loop up to recalculate the next run.
+		changed chan struct{}
+	}
+
+	// schedulerState is the part of the scheduler state kept between restarts,
+	// so they neither run a poll right away nor lose runtime decisions.
+	schedulerState struct {
+		Paused bool `json:"paused,omitempty"`
+		// Interval is set if it has been changed at runtime.
+		Interval    time.Duration `json:"interval,omitempty"`
+		LastStart   time.Time     `json:"last_start,omitempty"`
+		LastOutcome string        `json:"last_outcome,omitempty"`
+		ChangedAt   time.Time     `json:"changed_at,omitempty"`
+		QuietSince  time.Time     `json:"quiet_since,omitempty"`
+		ErrorStreak int           `json:"error_streak,omitempty"`
+		Breaker     breakerState  `json:"breaker,omitempty"`
+		LastResults []Result      `json:"last_results,omitempty"`
+		Runs        []Result      `json:"runs,omitempty"`
+	}
+
+	// checkRequest is a request of a run out of the schedule,
+	// the reply is called with the results of the run.
+	checkRequest struct {
+		reply func([]Result)
+	}
+
+	// schedulerStatus is a snapshot of the scheduler state.
+	schedulerStatus struct {
+		Paused   bool          `json:"paused"`
+		Interval time.Duration `json:"interval"`
+		// CurrentInterval is the interval of the active schedule window,
+		// zero if polling is off by the schedule.
+		CurrentInterval time.Duration `json:"current_interval"`
+		NextRun         time.Time     `json:"next_run,omitempty"`
+		LastResults     []Result      `json:"last_results,omitempty"`
+		ErrorStreak     int           `json:"error_streak"`
+		Breaker         breakerState  `json:"breaker"`
+	}
+)
+
+func newScheduler(name string, interval time.Duration, schedule *Schedule, adaptive *AdaptivePolling, jitter float64, backoff ErrorBackoff) *scheduler {
+	setBreakerMetric(name, breakerClosed)
+
+	return &scheduler{
+		name:         name,
+		interval:     interval,
+		schedule:     schedule,
+		adaptive:     adaptive,
+		jitter:       jitter,
+		jitterFactor: 1,
+		backoff:      backoff,
+		breaker:      breakerClosed,
+		trigger:      make(chan checkRequest, 1),
+		changed:      make(chan struct{}, 1),
+	}
+}
+
+// status returns a snapshot of the state.
+func (s *scheduler) status() schedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := schedulerStatus{
+		Paused:      s.paused,
+		Interval:    s.interval,
+		LastResults: s.lastResults,
+
+		CurrentInterval: s.schedule.intervalAt(time.Now(), s.interval),
+		ErrorStreak:     s.errorStreak,
+		Breaker:         s.breaker,
+	}
+	if !s.paused {
+		st.NextRun = s.nextRun()
+	}
+
+	return st
+}
+
+// nextRun returns the zero time if there is no run within the schedule
+// horizon. Must be called with the mu held.
+func (s *scheduler) nextRun() time.Time {
+	now := time.Now()
+
+	return s.schedule.next(s.lastStart, now, s.interval, func(iv time.Duration) time.Duration {
+		iv = s.adaptive.interval(iv, now, s.changedAt, s.quietSince)
+		iv = s.backoff.interval(iv, s.errorStreak, s.breaker)
+		return time.Duration(float64(iv) * s.jitterFactor)
+	})
+}
+
+// runDeadline returns the time a successful run has to finish by, that's
+// the window and the current interval after the last one, the start or
+// the resumption of the polling. The zero time is returned if the polling
+// is paused, either at runtime or by the schedule.
+func (s *scheduler) runDeadline(now, start time.Time, window time.Duration) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused {
+		return time.Time{}
+	}
+	iv := s.schedule.intervalAt(now, s.interval)
+	if iv == 0 {
+		return time.Time{}
+	}
+	limit := window + s.adaptive.interval(iv, now, s.changedAt, s.quietSince)
+
+	since := start
+	if s.resumedAt.After(since) {
+		since = s.resumedAt
+	}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if s.runs[i].Error != "" {
+			continue
+		}
+		if finished := s.runs[i].StartedAt.Add(s.runs[i].Duration); finished.After(since) {
+			since = finished
+		}
+		break
+	}
+	if active := s.schedule.activeSince(now, limit); active.After(since) {
+		since = active
+	}
+
+	return since.Add(limit)
+}
+
+// untilNextRun returns the duration until the next scheduled run,
+// or a negative duration if the polling is paused.
+func (s *scheduler) untilNextRun(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused {
+		return -1
+	}
+
+	next := s.nextRun()
+	if next.IsZero() {
+		// nothing is scheduled, look again later
+		return scheduleHorizon
+	}
+	if wait := next.Sub(now); wait > 0 {
+		return wait
+	}
+
+	return 0
+}
+
+func (s *scheduler) started(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastStart = at
+	s.jitterFactor = jitterFactor(s.jitter)
+	if s.breaker == breakerOpen {
+		s.breaker = breakerHalfOpen
+		setBreakerMetric(s.name, s.breaker)
+	}
+}
+
+// finished tracks the results of the poll, it returns the kind of
+// the circuit breaker notification if its state has changed along with
+// the number of consecutive failed polls.
+func (s *scheduler) finished(results []Result) (NotificationKind, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(results) == 0 {
+		if s.breaker == breakerHalfOpen {
+			s.breaker = breakerOpen
+			setBreakerMetric(s.name, s.breaker)
+		}
+		return "", 0
+	}
+
+	s.lastResults = make([]Result, 0, len(results))
+	for _, res := range results {
+		res.Screenshot = nil
+		s.lastResults = append(s.lastResults, res)
+	}
+
+	outcome, slots := outcomeOf(results)
+	if outcome != "" {
+		if s.quietSince.IsZero() {
+			s.quietSince = time.Now()
+		}
+		if slots || (s.lastOutcome != "" && outcome != s.lastOutcome) {
+			s.changedAt = time.Now()
+		}
+		s.lastOutcome = outcome
+	}
+
+	for _, res := range results {
+		res.Screenshot = nil
+		s.runs = append(s.runs, res)
+	}
+	if len(s.runs) > historySize {
+		s.runs = append([]Result(nil), s.runs[len(s.runs)-historySize:]...)
+	}
+
+	failed := true
+	for _, res := range results {
+		failed = failed && res.Error != ""
+	}
+
+	var kind NotificationKind
+	failures := s.errorStreak
+	if failed {
+		s.errorStreak++
+		failures = s.errorStreak
+
+		switch {
+		case s.breaker == breakerHalfOpen:
+			s.breaker = breakerOpen
+		case s.breaker == breakerClosed && s.errorStreak >= s.backoff.BreakerThreshold:
+			s.breaker, kind = breakerOpen, KindBreakerOpen
+		}
+	} else {
+		if s.breaker != breakerClosed {
+			s.breaker, kind = breakerClosed, KindBreakerClosed
+		}
+		s.errorStreak = 0
+	}
+	setBreakerMetric(s.name, s.breaker)
+	consecutiveFailures.WithLabelValues(s.name).Set(float64(s.errorStreak))
+
+	return kind, failures
+}
+
+// outcomeOf describes the outcome of the run results to compare them,
+// it also reports whether slots were seen. Failed runs are left out,
+// the error backoff takes care of them.
+func outcomeOf(results []Result) (outcome string, slots bool) {
+	var sb strings.Builder
+	for _, res := range results {
+		if res.Error != "" {
+			continue
+		}
+
+		sb.WriteString(res.Profile.key())
+		switch {
+		case res.SlotsAvailable:
+			sb.WriteString("=slots;")
+			slots = true
+		default:
+			sb.WriteString("=none;")
+		}
+	}
+
+	return sb.String(), slots
+}
+
+// history returns up to n last run results, the newest first.
+func (s *scheduler) history(n int) []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n > len(s.runs) {
+		n = len(s.runs)
+	}
+
+	res := make([]Result, 0, n)
+	for i := len(s.runs) - 1; i >= len(s.runs)-n; i-- {
+		res = append(res, s.runs[i])
+	}
+
+	return res
+}
+
+// snapshot returns the state to keep between restarts.
+func (s *scheduler) snapshot() *schedulerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &schedulerState{
+		Paused:      s.paused,
+		LastStart:   s.lastStart,
+		LastOutcome: s.lastOutcome,
+		ChangedAt:   s.changedAt,
+		QuietSince:  s.quietSince,
+		ErrorStreak: s.errorStreak,
+		Breaker:     s.breaker,
+		LastResults: s.lastResults,
+		Runs:        s.runs,
+	}
+	if s.intervalSet {
+		st.Interval = s.interval
+	}
+
+	return st
+}
+
+// restore brings the state kept before the restart back.
+func (s *scheduler) restore(st *schedulerState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = st.Paused
+	if st.Interval > 0 {
+		s.interval, s.intervalSet = st.Interval, true
+	}
+	s.lastStart = st.LastStart
+	s.lastOutcome = st.LastOutcome
+	s.changedAt = st.ChangedAt
+	s.quietSince = st.QuietSince
+	s.errorStreak = st.ErrorStreak
+	if st.Breaker != "" {
+		s.breaker = st.Breaker
+	}
+	if s.breaker == breakerHalfOpen {
+		// the probe has been interrupted by the restart
+		s.breaker = breakerOpen
+	}
+	s.lastResults = st.LastResults
+	s.runs = st.Runs
+	if len(s.runs) > historySize {
+		s.runs = s.runs[len(s.runs)-historySize:]
+	}
+
+	setBreakerMetric(s.name, s.breaker)
+	consecutiveFailures.WithLabelValues(s.name).Set(float64(s.errorStreak))
+}
+
+// setPaused pauses or resumes the polling, it returns false
+// if the state has not been changed.
+func (s *scheduler) setPaused(paused bool) bool {
+	s.mu.Lock()
+	changed := s.paused != paused
+	s.paused = paused
+	if changed && !paused {
+		s.resumedAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.wake()
+	}
+
+	return changed
+}
+
+func (s *scheduler) setInterval(interval time.Duration) {
+	s.mu.Lock()
+	s.interval = interval
+	s.intervalSet = true
+	s.mu.Unlock()
+
+	s.wake()
+}
+
+// requestCheck asks the poll loop to run out of the schedule, it returns
+// false if a check has been already requested.
+func (s *scheduler) requestCheck(reply func([]Result)) bool {
+	select {
+	case s.trigger <- checkRequest{reply: reply}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *scheduler) wake() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// poll runs the cycles of the watch according to its scheduler
+// until the context is done.
+func (r *Runner) poll(ctx context.Context, w *watch) {
+	w.polling.Store(true)
+	defer w.polling.Store(false)
+
+	for {
+		var (
+			timer *time.Timer
+			fire  <-chan time.Time
+		)
+		if wait := w.sched.untilNextRun(time.Now()); wait >= 0 {
+			timer = time.NewTimer(wait)
+			fire = timer.C
+		}
+
+		// cycles run in background to keep the schedule, overlapping
+		// runs are handled according to the overlap policy
+		select {
+		case <-fire:
+			w.sched.started(time.Now())
+			go r.cycle(w)
+
+		case req := <-w.sched.trigger:
+			w.sched.started(time.Now())
+			go func() {
+				results := r.cycle(w)
+				if req.reply != nil {
+					req.reply(results)
+				}
+			}()
+
+		case <-w.sched.changed:
+
+		case <-ctx.Done():
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
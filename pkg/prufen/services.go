@@ -0,0 +1,71 @@
+package prufen
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultService is the service the Profile is checked for if none is set.
+const DefaultService = "blue_card"
+
+const (
+	// DefaultApplicationSelector is the XPath of applying for a residence title.
+	DefaultApplicationSelector = `//*[@id="xi-div-30"]/div[1]`
+	// DefaultCategoriesSelector is the XPath of the reasons categories
+	// of a residence title.
+	DefaultCategoriesSelector = `//*[@id="inner-160-0-1"]`
+)
+
+// Service is a service of the ABH/LEA to book an appointment for.
+type Service struct {
+	// Name is shown to users.
+	Name string
+	// CategorySelector is the XPath of the reasons category to click,
+	// e.g. the economic activity.
+	CategorySelector string
+	// ServiceSelector is the XPath of the service to click in the category.
+	ServiceSelector string
+	// ApplicationSelector is the XPath of the kind of application to click,
+	// defaults to the DefaultApplicationSelector.
+	ApplicationSelector string
+	// CategoriesSelector is the XPath of the categories to wait for once
+	// the application is chosen, defaults to the DefaultCategoriesSelector.
+	CategoriesSelector string
+}
+
+// DefaultServices are always available in addition to the configured ones.
+var DefaultServices = map[string]Service{
+	DefaultService: {
+		Name:             "EU Blue Card",
+		CategorySelector: `//*[@id="inner-160-0-1"]/div/div[3]`,
+		ServiceSelector:  `//*[@id="SERVICEWAHL_EN160-0-1-1-324659"]`,
+	},
+}
+
+func (s Service) validate() error {
+	if s.Name == "" || s.CategorySelector == "" || s.ServiceSelector == "" {
+		return fmt.Errorf("name, category and service selectors are required")
+	}
+
+	return nil
+}
+
+func (s *Service) setDefaults() {
+	if s.ApplicationSelector == "" {
+		s.ApplicationSelector = DefaultApplicationSelector
+	}
+	if s.CategoriesSelector == "" {
+		s.CategoriesSelector = DefaultCategoriesSelector
+	}
+}
+
+// serviceKeys returns keys of the known services in a stable order.
+func (r *Runner) serviceKeys() []string {
+	keys := make([]string, 0, len(r.services))
+	for k := range r.services {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,131 @@
+package prufen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const stateFileName = "state.json"
+
+// persistentState is stored in the state directory between restarts.
+type persistentState struct {
+	// Profiles hold the notifications state per each profile key.
+	Profiles map[string]*notifyState `json:"profiles,omitempty"`
+	// Alerts are not yet acknowledged alerts.
+	Alerts []*alert `json:"alerts,omitempty"`
+	// Snoozed hold the time until notifications are not sent per notifier ID.
+	Snoozed map[string]time.Time `json:"snoozed,omitempty"`
+	// StatusMessages hold the status message ID per recipient.
+	StatusMessages map[string]int `json:"status_messages,omitempty"`
+	// Schedulers hold the scheduler state per watch name.
+	Schedulers map[string]*schedulerState `json:"schedulers,omitempty"`
+}
+
+// loadState reads the state from the state directory, if any.
+func (r *Runner) loadState() error {
+	if r.stateDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(r.stateDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	return readJSONFile(filepath.Join(r.stateDir, stateFileName), &r.state)
+}
+
+// notifyState returns the notifications state of the profile.
+// Must be called with the stateMu held.
+func (r *Runner) notifyState(p Profile) *notifyState {
+	if r.state.Profiles == nil {
+		r.state.Profiles = map[string]*notifyState{}
+	}
+
+	st, ok := r.state.Profiles[p.key()]
+	if !ok {
+		st = &notifyState{}
+		r.state.Profiles[p.key()] = st
+	}
+
+	return st
+}
+
+// restoreSchedulers brings the state of the watches' schedulers back.
+func (r *Runner) restoreSchedulers() {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	for _, w := range r.watches {
+		if st, ok := r.state.Schedulers[w.name]; ok {
+			w.sched.restore(st)
+		}
+	}
+}
+
+// saveSchedulers keeps the state of the watches' schedulers in the state.
+func (r *Runner) saveSchedulers() {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	r.state.Schedulers = make(map[string]*schedulerState, len(r.watches))
+	for _, w := range r.watches {
+		r.state.Schedulers[w.name] = w.sched.snapshot()
+	}
+	r.saveState()
+}
+
+// saveState writes the state to the state directory, if any.
+// Must be called with the stateMu held.
+func (r *Runner) saveState() {
+	if r.stateDir == "" {
+		return
+	}
+
+	if err := writeJSONFile(filepath.Join(r.stateDir, stateFileName), r.state); err != nil {
+		r.logger.Error("failed to save state", "error", err)
+	}
+}
+
+// readJSONFile decodes the file into v, a missing file is not an error.
+func readJSONFile(path string, v any) error {
+	bb, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", path, err)
+	}
+
+	if err := json.Unmarshal(bb, v); err != nil {
+		return fmt.Errorf("failed to decode %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeJSONFile atomically replaces the file with encoded v.
+func writeJSONFile(path string, v any) error {
+	bb, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %q: %w", path, err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bb, 0o644); err != nil {
+		return fmt.Errorf("failed to write %q: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace %q: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package prufen
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// persistentErrorStreak is the number of consecutive failed runs of a profile
+// to notify about if the status message is enabled, and to notify
+// the subscribers of the profile about.
+const persistentErrorStreak = 3
+
+// quiet reports whether the notification is shown only in the status message
+// instead of being sent, errStreak is the number of consecutive failed runs.
+func (r *Runner) quiet(kind NotificationKind, errStreak int) bool {
+	if !r.statusMessage {
+		return false
+	}
+
+	switch kind {
+	case KindNoSlots:
+		return true
+	case KindError:
+		return errStreak != persistentErrorStreak
+	default:
+		return false
+	}
+}
+
+// updateStatusMessages edits the status message of each recipient in place,
+// a new one is sent and pinned if there is none yet, or it's been deleted.
+// Each recipient sees the status of the watches it's notified about.
+func (r *Runner) updateStatusMessages() {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	recipients, watches := r.statusRecipients()
+	for _, rc := range recipients {
+		key := rc.String()
+		text := r.describeWatchesStatus(watches[key])
+
+		r.stateMu.Lock()
+		messageID := r.state.StatusMessages[key]
+		r.stateMu.Unlock()
+
+		if messageID != 0 {
+			err := r.editStatusMessage(rc, messageID, text)
+			if err == nil {
+				continue
+			}
+			r.logger.Warn("failed to edit status message, sending a new one", "chat", key, "error", err)
+		}
+
+		messageID, err := r.sendStatusMessage(rc, text)
+		if err != nil {
+			r.logger.Error("failed to send status message", "chat", key, "error", err)
+			continue
+		}
+
+		r.stateMu.Lock()
+		if r.state.StatusMessages == nil {
+			r.state.StatusMessages = map[string]int{}
+		}
+		r.state.StatusMessages[key] = messageID
+		r.saveState()
+		r.stateMu.Unlock()
+	}
+}
+
+// statusRecipients returns the Telegram recipients of the watches along with
+// the watches of each one by the recipient key.
+func (r *Runner) statusRecipients() ([]TelegramRecipient, map[string][]*watch) {
+	var recipients []TelegramRecipient
+	watches := map[string][]*watch{}
+	for _, w := range r.watches {
+		for _, n := range r.operatorTargets(w) {
+			tn, ok := n.(*telegramNotifier)
+			if !ok || tn.escalationOnly {
+				continue
+			}
+
+			key := tn.to.String()
+			if _, ok := watches[key]; !ok {
+				recipients = append(recipients, tn.to)
+			}
+			watches[key] = append(watches[key], w)
+		}
+	}
+
+	return recipients, watches
+}
+
+func (r *Runner) editStatusMessage(to TelegramRecipient, messageID int, text string) error {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", to.ChatID)
+	params.AddNonZero("message_id", messageID)
+	params["text"] = text
+	params.AddBool("disable_web_page_preview", true)
+
+	_, err := r.botClient.MakeRequest("editMessageText", params)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+
+	return err
+}
+
+// sendStatusMessage sends and pins a new status message, it returns the message ID.
+func (r *Runner) sendStatusMessage(to TelegramRecipient, text string) (int, error) {
+	params := to.params("")
+	params["text"] = text
+	params.AddBool("disable_web_page_preview", true)
+	params.AddBool("disable_notification", true)
+
+	resp, err := r.botClient.MakeRequest("sendMessage", params)
+	if err != nil {
+		return 0, err
+	}
+
+	var msg tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &msg); err != nil {
+		return 0, fmt.Errorf("failed to decode sent message: %w", err)
+	}
+
+	pin := tgbotapi.PinChatMessageConfig{ChatID: to.ChatID, MessageID: msg.MessageID, DisableNotification: true}
+	if _, err := r.botClient.Request(pin); err != nil {
+		// the bot is not allowed to pin messages, the status is updated anyway
+		r.logger.Warn("failed to pin status message", "chat", to.String(), "error", err)
+	}
+
+	return msg.MessageID, nil
+}
@@ -0,0 +1,33 @@
+package prufen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatusRecipients(t *testing.T) {
+	r := &Runner{}
+	admin := r.register(&telegramNotifier{r: r, to: TelegramRecipient{ChatID: 1}})
+	family := r.register(&telegramNotifier{r: r, to: TelegramRecipient{ChatID: 2, ThreadID: 7}})
+	r.register(&telegramNotifier{r: r, to: TelegramRecipient{ChatID: 3}, escalationOnly: true})
+
+	self := &watch{name: "default", targets: []notifier{admin}}
+	spouse := &watch{name: "spouse", targets: []notifier{admin, family}}
+	subs := &watch{name: subscriptionsWatchName}
+	r.watches = []*watch{self, spouse, subs}
+
+	recipients, watches := r.statusRecipients()
+
+	wantRecipients := []TelegramRecipient{{ChatID: 1}, {ChatID: 2, ThreadID: 7}}
+	if !reflect.DeepEqual(recipients, wantRecipients) {
+		t.Errorf("recipients = %v, want %v", recipients, wantRecipients)
+	}
+
+	wantWatches := map[string][]*watch{
+		"1":   {self, spouse, subs},
+		"2/7": {spouse, subs},
+	}
+	if !reflect.DeepEqual(watches, wantWatches) {
+		t.Errorf("watches = %v, want %v", watches, wantWatches)
+	}
+}
@@ -0,0 +1,176 @@
+package prufen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// StopConditions make the Runner stop by itself, polling goes on
+	// until the context is done if none of them are set.
+	StopConditions struct {
+		// UntilFound stops once slots are found for any of the watched profiles.
+		UntilFound bool
+		// MaxRuns stops after the given number of runs across all of the profiles.
+		MaxRuns int
+		// Deadline stops at the given time, e.g. once an appointment
+		// is not useful anymore.
+		Deadline time.Time
+	}
+
+	// StopReason tells why the Runner has stopped by itself.
+	StopReason string
+
+	// StoppedError is returned by the Run once one of the StopConditions is met.
+	StoppedError struct {
+		Reason StopReason
+		// Runs is the number of runs done before the stop.
+		Runs int
+	}
+
+	// stopper tracks the StopConditions and cancels polling once one of them is met.
+	stopper struct {
+		conditions StopConditions
+
+		mu     sync.Mutex
+		runs   int
+		reason StopReason
+		cancel context.CancelFunc
+	}
+)
+
+const (
+	// StopFound is the reason of the StopConditions.UntilFound.
+	StopFound StopReason = "found"
+	// StopMaxRuns is the reason of the StopConditions.MaxRuns.
+	StopMaxRuns StopReason = "max_runs"
+	// StopDeadline is the reason of the StopConditions.Deadline.
+	StopDeadline StopReason = "deadline"
+)
+
+func (e *StoppedError) Error() string {
+	return fmt.Sprintf("stopped by the %q condition after %d runs", e.Reason, e.Runs)
+}
+
+func (c StopConditions) validate() error {
+	if c.MaxRuns < 0 {
+		return fmt.Errorf("negative max runs")
+	}
+
+	return nil
+}
+
+// start binds the stopper to the cancel function of polling.
+func (s *stopper) start(cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancel = cancel
+}
+
+// finished counts the results of the poll of the watch, it returns
+// true if polling has to stop because of them.
+func (s *stopper) finished(w *watch, results []Result) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs += len(results)
+
+	if s.conditions.UntilFound && w.profile != nil {
+		for _, res := range results {
+			if res.SlotsAvailable {
+				return s.stop(StopFound)
+			}
+		}
+	}
+	if s.conditions.MaxRuns > 0 && s.runs >= s.conditions.MaxRuns {
+		return s.stop(StopMaxRuns)
+	}
+
+	return false
+}
+
+// stop sets the reason unless polling has been already stopped, it returns
+// false in the latter case. Must be called with the mu held.
+func (s *stopper) stop(reason StopReason) bool {
+	if s.reason != "" {
+		return false
+	}
+
+	s.reason = reason
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	return true
+}
+
+// stopped returns the error describing the stop, nil if polling has not stopped.
+func (s *stopper) stopped() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reason == "" {
+		return nil
+	}
+
+	return &StoppedError{Reason: s.reason, Runs: s.runs}
+}
+
+// checkStop stops polling if the results of the watch meet the stop conditions.
+func (r *Runner) checkStop(w *watch, results []Result) {
+	if !r.stopper.finished(w, results) {
+		return
+	}
+
+	r.notifyStopped(results)
+}
+
+// awaitDeadline stops polling at the deadline, if any, until the context is done.
+func (r *Runner) awaitDeadline(ctx context.Context) {
+	deadline := r.stopper.conditions.Deadline
+	if deadline.IsZero() {
+		return
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return
+	}
+
+	r.stopper.mu.Lock()
+	stopped := r.stopper.stop(StopDeadline)
+	r.stopper.mu.Unlock()
+
+	if stopped {
+		r.notifyStopped(nil)
+	}
+}
+
+// notifyStopped sends the final notification to the configured notifiers.
+func (r *Runner) notifyStopped(results []Result) {
+	err, _ := r.stopper.stopped().(*StoppedError)
+	if err == nil {
+		return
+	}
+
+	data := messageData{Kind: KindStopped, StopReason: err.Reason, Runs: err.Runs}
+	for _, res := range results {
+		if res.SlotsAvailable || data.StartedAt.IsZero() {
+			data.Result = res
+		}
+	}
+	data.Screenshot = nil
+
+	r.logger.Warn("stop condition is met, stopping", "reason", err.Reason, "runs", err.Runs)
+	for _, w := range r.watches {
+		r.stateChanged(w, "stopped")
+	}
+	r.notify(data, r.notifiers)
+}
@@ -0,0 +1,418 @@
+package prufen
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	subscriptionsFileName = "subscriptions.json"
+
+	// callbackSubscribe is the callback data prefix of the subscription
+	// questions buttons, followed by the step and the answer.
+	callbackSubscribe = "sub"
+
+	stepCitizenship = "cz"
+	stepPeople      = "num"
+	stepBerlin      = "berlin"
+	stepFamily      = "fam"
+	stepService     = "svc"
+)
+
+// DefaultSubscribeCitizenships are offered as buttons on the subscription,
+// any other citizenship could be typed in as it's named on the ABH/LEA site.
+var DefaultSubscribeCitizenships = []string{
+	"Russian Federation",
+	"Ukraine",
+	"Belarus",
+	"India",
+	"Turkey",
+	"China",
+	"Iran",
+	"Brazil",
+}
+
+type (
+	// subscriptions are profiles of the bot users, each chat
+	// is subscribed to a single profile.
+	subscriptions struct {
+		mu     sync.Mutex
+		path   string
+		byChat map[int64]Profile
+		// flows are subscriptions in progress.
+		flows map[int64]*subscribeFlow
+	}
+
+	// subscribeFlow is a conversation to fill a profile in.
+	subscribeFlow struct {
+		step    string
+		profile Profile
+	}
+)
+
+func newSubscriptions(stateDir string) (*subscriptions, error) {
+	s := &subscriptions{
+		byChat: map[int64]Profile{},
+		flows:  map[int64]*subscribeFlow{},
+	}
+	if stateDir == "" {
+		return s, nil
+	}
+
+	s.path = filepath.Join(stateDir, subscriptionsFileName)
+	if err := readJSONFile(s.path, &s.byChat); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// get returns the profile of the chat.
+func (s *subscriptions) get(chatID int64) (Profile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.byChat[chatID]
+	return p, ok
+}
+
+// remove unsubscribes the chat, it returns false if it was not subscribed.
+func (s *subscriptions) remove(chatID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.flows, chatID)
+	if _, ok := s.byChat[chatID]; !ok {
+		return false, nil
+	}
+	delete(s.byChat, chatID)
+
+	return true, s.save()
+}
+
+// profiles returns distinct profiles of all subscribers.
+func (s *subscriptions) profiles() []Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[string]bool{}
+	var res []Profile
+	for _, p := range s.byChat {
+		if seen[p.key()] {
+			continue
+		}
+		seen[p.key()] = true
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].key() < res[j].key() })
+
+	return res
+}
+
+// chatsFor returns chats subscribed to the profile.
+func (s *subscriptions) chatsFor(p Profile) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []int64
+	for chatID, sp := range s.byChat {
+		if sp.key() == p.key() {
+			res = append(res, chatID)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+
+	return res
+}
+
+// profilesWith returns the number of distinct profiles if the chat
+// subscribes to the given one. Must be called with the mu held.
+func (s *subscriptions) profilesWith(chatID int64, p Profile) int {
+	seen := map[string]bool{p.key(): true}
+	for id, sp := range s.byChat {
+		if id != chatID {
+			seen[sp.key()] = true
+		}
+	}
+
+	return len(seen)
+}
+
+// save must be called with the mu held.
+func (s *subscriptions) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	return writeJSONFile(s.path, s.byChat)
+}
+
+// notifySubscriptionFailing tells the subscribers of the profile that its runs
+// keep failing, e.g. because of a misspelled citizenship, since they are
+// not notified about failed runs otherwise.
+func (r *Runner) notifySubscriptionFailing(data messageData, failures int) {
+	subscribers := map[string]bool{}
+	for _, chatID := range r.subs.chatsFor(data.Profile) {
+		if id := r.subscriberNotifier(chatID).id(); !r.configuredNotifier(id) {
+			subscribers[id] = true
+		}
+	}
+	if len(subscribers) == 0 {
+		return
+	}
+
+	var targets []notifier
+	for _, n := range r.targets(data.Profile) {
+		if subscribers[n.id()] {
+			targets = append(targets, n)
+		}
+	}
+
+	data.Kind, data.Failures = KindSubscriptionFailing, failures
+	data.Screenshot = nil
+	r.notify(data, targets)
+}
+
+// subscriberNotifier sends notifications to a subscribed chat.
+func (r *Runner) subscriberNotifier(chatID int64) notifier {
+	return &telegramNotifier{r: r, to: TelegramRecipient{ChatID: chatID, Level: LevelSlots}}
+}
+
+func (r *Runner) handleSubscriptionCommand(msg *tgbotapi.Message) {
+	if !r.subscriptionsEnabled {
+		r.reply(msg, "Subscriptions are disabled for this bot")
+		return
+	}
+
+	chatID := msg.Chat.ID
+
+	switch msg.Command() {
+	case "subscribe":
+		r.subs.mu.Lock()
+		r.subs.flows[chatID] = &subscribeFlow{step: stepCitizenship}
+		r.subs.mu.Unlock()
+
+		text, markup := r.subscribeQuestion(stepCitizenship)
+		r.replyWithKeyboard(msg, text, markup)
+
+	case "unsubscribe":
+		removed, err := r.subs.remove(chatID)
+		switch {
+		case err != nil:
+			r.logger.Error("failed to save subscriptions", "error", err)
+			r.reply(msg, "Failed to unsubscribe, please try again later")
+		case !removed:
+			r.reply(msg, "You are not subscribed")
+		default:
+			r.logger.Info("chat unsubscribed", "chat", chatID)
+			r.reply(msg, "You are unsubscribed")
+		}
+
+	case "subscription":
+		p, ok := r.subs.get(chatID)
+		if !ok {
+			r.reply(msg, "You are not subscribed, use /subscribe to start")
+			return
+		}
+		r.reply(msg, "You are subscribed to:\n"+r.describeProfile(p))
+	}
+}
+
+// handleSubscriptionText takes a typed in answer of the subscription flow.
+func (r *Runner) handleSubscriptionText(msg *tgbotapi.Message) {
+	r.subs.mu.Lock()
+	flow, ok := r.subs.flows[msg.Chat.ID]
+	step := ""
+	if ok {
+		step = flow.step
+	}
+	r.subs.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if step != stepCitizenship && step != stepFamily {
+		r.reply(msg, "Please choose one of the options above")
+		return
+	}
+
+	text, markup := r.subscribeAnswer(msg.Chat.ID, step, strings.TrimSpace(msg.Text))
+	r.replyWithKeyboard(msg, text, markup)
+}
+
+// handleSubscriptionCallback takes a button answer of the subscription flow.
+func (r *Runner) handleSubscriptionCallback(cq *tgbotapi.CallbackQuery, arg string) {
+	if cq.Message == nil {
+		r.answerCallback(cq, "")
+		return
+	}
+
+	step, value, _ := strings.Cut(arg, ":")
+	if step == stepCitizenship || step == stepFamily {
+		// the citizenships are passed as indexes to fit into the callback data
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 || i >= len(r.subscribeCitizenships) {
+			r.answerCallback(cq, "Unknown citizenship")
+			return
+		}
+		value = r.subscribeCitizenships[i]
+	}
+
+	r.answerCallback(cq, "")
+
+	text, markup := r.subscribeAnswer(cq.Message.Chat.ID, step, value)
+	edit := tgbotapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, text)
+	edit.ReplyMarkup = markup
+	if _, err := r.botClient.Request(edit); err != nil {
+		r.logger.Error("failed to edit subscription message", "error", err)
+	}
+}
+
+// subscribeAnswer moves the flow to the next step and returns the next question.
+func (r *Runner) subscribeAnswer(chatID int64, step, value string) (string, *tgbotapi.InlineKeyboardMarkup) {
+	r.subs.mu.Lock()
+	defer r.subs.mu.Unlock()
+
+	flow, ok := r.subs.flows[chatID]
+	if !ok || flow.step != step {
+		return "This question is outdated, use /subscribe to start over", nil
+	}
+	if value == "" {
+		return r.subscribeQuestion(step)
+	}
+
+	switch step {
+	case stepCitizenship:
+		flow.profile.Citizenship = value
+		flow.step = stepPeople
+	case stepPeople:
+		flow.profile.PeopleNumber = value
+		flow.step = stepBerlin
+	case stepBerlin:
+		flow.profile.LiveInBerlin = value
+		flow.step = stepService
+		if value == "yes" {
+			flow.step = stepFamily
+		}
+	case stepFamily:
+		flow.profile.FamilyMemberCitizenship = value
+		flow.step = stepService
+	case stepService:
+		if _, ok := r.services[value]; !ok {
+			return r.subscribeQuestion(step)
+		}
+		flow.profile.Service = value
+
+		delete(r.subs.flows, chatID)
+		if r.subs.profilesWith(chatID, flow.profile) > r.maxSubscribedProfiles {
+			r.logger.Warn("too many subscribed profiles", "chat", chatID, "profile", flow.profile.key())
+			return "Too many different profiles are checked already, please try again later, or /subscribe to a profile someone is subscribed to", nil
+		}
+		prev, wasSubscribed := r.subs.byChat[chatID]
+		r.subs.byChat[chatID] = flow.profile
+		if err := r.subs.save(); err != nil {
+			r.logger.Error("failed to save subscriptions", "error", err)
+			if wasSubscribed {
+				r.subs.byChat[chatID] = prev
+			} else {
+				delete(r.subs.byChat, chatID)
+			}
+			return "Failed to subscribe, please try again later", nil
+		}
+		r.logger.Info("chat subscribed", "chat", chatID, "profile", flow.profile.key())
+
+		return "You are subscribed to:\n" + r.describeProfile(flow.profile) +
+			"\n\nYou'll be notified once slots are available. Use /unsubscribe to stop.", nil
+	}
+
+	return r.subscribeQuestion(flow.step)
+}
+
+// subscribeQuestion returns the question of the step along with answers.
+func (r *Runner) subscribeQuestion(step string) (string, *tgbotapi.InlineKeyboardMarkup) {
+	var (
+		text string
+		rows [][]tgbotapi.InlineKeyboardButton
+	)
+
+	button := func(label, value string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(label, callbackSubscribe+":"+step+":"+value)
+	}
+
+	switch step {
+	case stepCitizenship, stepFamily:
+		text = "Choose your citizenship, or type it in as it's named on the ABH site:"
+		if step == stepFamily {
+			text = "Choose the citizenship of your family member, or type it in as it's named on the ABH site:"
+		}
+		for i, cz := range r.subscribeCitizenships {
+			if i%2 == 0 {
+				rows = append(rows, nil)
+			}
+			rows[len(rows)-1] = append(rows[len(rows)-1], button(cz, strconv.Itoa(i)))
+		}
+
+	case stepPeople:
+		text = "How many people are applying, including you?"
+		rows = make([][]tgbotapi.InlineKeyboardButton, 2)
+		for n := 1; n <= 8; n++ {
+			rows[(n-1)/4] = append(rows[(n-1)/4], button(strconv.Itoa(n), strconv.Itoa(n)))
+		}
+
+	case stepBerlin:
+		text = "Do you live in Berlin with a family member?"
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(button("Yes", "yes"), button("No", "no")))
+
+	case stepService:
+		text = "Choose the service:"
+		for _, key := range r.serviceKeys() {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(button(r.services[key].Name, key)))
+		}
+	}
+
+	if len(rows) == 0 {
+		return text, nil
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return text, &markup
+}
+
+func (r *Runner) describeProfile(p Profile) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Citizenship: %s\n", p.Citizenship)
+	fmt.Fprintf(&sb, "People: %s\n", p.PeopleNumber)
+	fmt.Fprintf(&sb, "Live in Berlin with a family member: %s\n", p.LiveInBerlin)
+	if p.FamilyMemberCitizenship != "" {
+		fmt.Fprintf(&sb, "Family member citizenship: %s\n", p.FamilyMemberCitizenship)
+	}
+
+	service := p.Service
+	if s, ok := r.services[service]; ok {
+		service = s.Name
+	}
+	fmt.Fprintf(&sb, "Service: %s", service)
+
+	return sb.String()
+}
+
+// replyWithKeyboard sends a plain text reply to the message with an optional keyboard.
+func (r *Runner) replyWithKeyboard(msg *tgbotapi.Message, text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	msgcfg := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgcfg.ReplyToMessageID = msg.MessageID
+	msgcfg.AllowSendingWithoutReply = true
+	if markup != nil {
+		msgcfg.ReplyMarkup = markup
+	}
+
+	if _, err := r.botClient.Send(msgcfg); err != nil {
+		r.logger.Error("failed to reply to subscription message", "chat", msg.Chat.ID, "error", err)
+	}
+}
@@ -0,0 +1,32 @@
+package prufen
+
+import "testing"
+
+func TestSubscriptionsProfilesWith(t *testing.T) {
+	ru := Profile{Citizenship: "Russian Federation", PeopleNumber: "1", Service: "blue-card"}
+	ua := Profile{Citizenship: "Ukraine", PeopleNumber: "1", Service: "blue-card"}
+	in := Profile{Citizenship: "India", PeopleNumber: "2", Service: "blue-card"}
+
+	s := &subscriptions{byChat: map[int64]Profile{1: ru, 2: ru, 3: ua}}
+
+	tests := []struct {
+		name   string
+		chatID int64
+		p      Profile
+		want   int
+	}{
+		{name: "existing profile", chatID: 4, p: ru, want: 2},
+		{name: "new profile", chatID: 4, p: in, want: 3},
+		{name: "same subscription", chatID: 3, p: ua, want: 2},
+		{name: "the only subscriber changes the profile", chatID: 3, p: in, want: 2},
+		{name: "one of subscribers changes the profile", chatID: 1, p: in, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.profilesWith(tt.chatID, tt.p); got != tt.want {
+				t.Errorf("profilesWith() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
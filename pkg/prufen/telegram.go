@@ -0,0 +1,137 @@
+package prufen
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type (
+	// TelegramRecipient is a chat, a group, or a channel
+	// which receives notifications.
+	TelegramRecipient struct {
+		// ChatID is the ID of a chat, negative for groups and channels.
+		ChatID int64
+		// ThreadID is the ID of a forum topic in a supergroup, optional.
+		ThreadID int
+		// Level selects notifications the recipient is subscribed to,
+		// defaults to the LevelSlots.
+		Level NotifyLevel
+	}
+
+	// NotifyLevel defines which kinds of notifications are sent to a recipient.
+	NotifyLevel string
+)
+
+const (
+	// LevelSlots subscribes only to available slots.
+	LevelSlots NotifyLevel = "slots"
+	// LevelErrors subscribes to available slots and failed runs.
+	LevelErrors NotifyLevel = "errors"
+	// LevelDebug subscribes to all of the notifications.
+	LevelDebug NotifyLevel = "debug"
+)
+
+func (l NotifyLevel) validate() error {
+	switch l {
+	case LevelSlots, LevelErrors, LevelDebug:
+		return nil
+	default:
+		return fmt.Errorf("unknown notify level %q", l)
+	}
+}
+
+func (l NotifyLevel) includes(kind NotificationKind) bool {
+	switch kind {
+	case KindSlots, KindSlotsGone, KindSlotsReminder, KindEscalation, KindStopped, KindSubscriptionFailing,
+		KindBreakerOpen, KindBreakerClosed:
+		return true
+	case KindError:
+		return l == LevelErrors || l == LevelDebug
+	default:
+		return l == LevelDebug
+	}
+}
+
+// validateRecipients checks the recipients and sets the default level.
+func validateRecipients(recipients []TelegramRecipient) error {
+	for i, rc := range recipients {
+		if rc.ChatID == 0 {
+			return fmt.Errorf("telegram recipient #%d has no chat ID", i)
+		}
+		if rc.Level == "" {
+			recipients[i].Level = LevelSlots
+		}
+		if err := recipients[i].Level.validate(); err != nil {
+			return fmt.Errorf("telegram recipient %s: %w", rc, err)
+		}
+	}
+
+	return nil
+}
+
+func (rc TelegramRecipient) String() string {
+	if rc.ThreadID != 0 {
+		return fmt.Sprintf("%d/%d", rc.ChatID, rc.ThreadID)
+	}
+	return fmt.Sprintf("%d", rc.ChatID)
+}
+
+// params returns the common params of send* methods.
+func (rc TelegramRecipient) params(parseMode string) tgbotapi.Params {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", rc.ChatID)
+	params.AddNonZero("message_thread_id", rc.ThreadID)
+	params.AddNonEmpty("parse_mode", parseMode)
+	params.AddBool("allow_sending_without_reply", true)
+
+	return params
+}
+
+// sendMessage sends a text message to a single recipient with an optional keyboard.
+// The tgbotapi configs lack forum topics, hence the raw requests.
+func (r *Runner) sendMessage(to TelegramRecipient, payload string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	params := to.params(r.templates.parseMode)
+	params["text"] = payload
+	params.AddBool("disable_web_page_preview", true)
+	if err := params.AddInterface("reply_markup", markup); err != nil {
+		return fmt.Errorf("failed to encode reply markup: %w", err)
+	}
+
+	if _, err := r.botClient.MakeRequest("sendMessage", params); err != nil {
+		return fmt.Errorf("failed to send message to telegram chat %s: %w", to, err)
+	}
+
+	return nil
+}
+
+// sendPhoto sends a JPEG image to a single recipient with the payload as its
+// caption. If the payload does not fit into a caption, it's sent as a
+// separate message after the image, the keyboard goes along with the payload.
+func (r *Runner) sendPhoto(to TelegramRecipient, payload string, photo []byte, markup *tgbotapi.InlineKeyboardMarkup) error {
+	captionFits := utf8.RuneCountInString(payload) <= maxCaptionLength
+
+	params := to.params("")
+	if captionFits {
+		params["caption"] = payload
+		params.AddNonEmpty("parse_mode", r.templates.parseMode)
+		if err := params.AddInterface("reply_markup", markup); err != nil {
+			return fmt.Errorf("failed to encode reply markup: %w", err)
+		}
+	}
+
+	files := []tgbotapi.RequestFile{{
+		Name: "photo",
+		Data: tgbotapi.FileBytes{Name: "screenshot.jpg", Bytes: photo},
+	}}
+	if _, err := r.botClient.UploadFiles("sendPhoto", params, files); err != nil {
+		return fmt.Errorf("failed to send photo to telegram chat %s: %w", to, err)
+	}
+
+	if !captionFits {
+		return r.sendMessage(to, payload, markup)
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package prufen
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultWatchName is the name of the watch of the profile
+	// given by the Citizenship and other options.
+	DefaultWatchName = "default"
+	// subscriptionsWatchName is the name of the watch of all
+	// the subscribers' profiles.
+	subscriptionsWatchName = "subscriptions"
+)
+
+type (
+	// Watch is a profile checked on its own schedule and notified
+	// to its own recipients.
+	Watch struct {
+		// Name identifies the watch in the bot commands and metrics.
+		Name    string
+		Profile Profile
+		// PollInterval defaults to the Options.PollInterval.
+		PollInterval time.Duration
+		// Schedule defaults to the Options.Schedule.
+		Schedule *Schedule
+		// TelegramRecipients get notifications of the profile, defaults
+		// to the TelegramChatID and TelegramRecipients of the Options.
+		TelegramRecipients []TelegramRecipient
+	}
+
+	// watch polls its profile, or the subscribers' profiles,
+	// with its own scheduler.
+	watch struct {
+		name string
+		// profile is nil for the watch of the subscribers' profiles.
+		profile *Profile
+		// targets are notified about the profile along with its subscribers.
+		targets []notifier
+		sched   *scheduler
+		// polling is set while the poll loop of the watch is running.
+		polling atomic.Bool
+	}
+)
+
+func (w Watch) validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("no name")
+	}
+	if w.Name == subscriptionsWatchName {
+		return fmt.Errorf("name %q is reserved", w.Name)
+	}
+	if w.Profile.Citizenship == "" {
+		return fmt.Errorf("no citizenship")
+	}
+	if w.PollInterval < 0 {
+		return fmt.Errorf("negative poll interval")
+	}
+
+	return nil
+}
+
+// activeProfile returns the profile of the watch unless it's done.
+func (r *Runner) activeProfile(w *watch) (Profile, bool) {
+	if w.profile == nil {
+		return Profile{}, false
+	}
+
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	if r.notifyState(*w.profile).Done {
+		return Profile{}, false
+	}
+
+	return *w.profile, true
+}
+
+// activeProfiles returns the profiles of the watches which are not done.
+func (r *Runner) activeProfiles() map[string]bool {
+	res := map[string]bool{}
+	for _, w := range r.watches {
+		if p, ok := r.activeProfile(w); ok {
+			res[p.key()] = true
+		}
+	}
+
+	return res
+}
+
+// profiles returns distinct profiles to check by the watch, the subscribers'
+// profiles which are watched on their own are left out.
+func (r *Runner) profiles(w *watch) []Profile {
+	if w.profile != nil {
+		if p, ok := r.activeProfile(w); ok {
+			return []Profile{p}
+		}
+		return nil
+	}
+
+	watched := r.activeProfiles()
+
+	var res []Profile
+	for _, p := range r.subs.profiles() {
+		if !watched[p.key()] {
+			res = append(res, p)
+		}
+	}
+
+	return res
+}
+
+// configuredProfile returns the profile of the first watch, if any.
+func (r *Runner) configuredProfile() (Profile, bool) {
+	for _, w := range r.watches {
+		if w.profile != nil {
+			return *w.profile, true
+		}
+	}
+
+	return Profile{}, false
+}
+
+// watchByRef returns the watch of the profile with the given ref.
+func (r *Runner) watchByRef(ref string) (*watch, bool) {
+	for _, w := range r.watches {
+		if w.profile != nil && w.profile.ref() == ref {
+			return w, true
+		}
+	}
+
+	return nil, false
+}
+
+// selectWatches returns the watch with the given name, or all of them if it's empty.
+func (r *Runner) selectWatches(name string) ([]*watch, error) {
+	if name == "" {
+		return r.watches, nil
+	}
+
+	for _, w := range r.watches {
+		if w.name == name {
+			return []*watch{w}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown watch %q", name)
+}
+
+// history returns up to n last runs of the watches, the newest first.
+func (r *Runner) history(watches []*watch, n int) []Result {
+	var runs []Result
+	for _, w := range watches {
+		runs = append(runs, w.sched.history(n)...)
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if len(runs) > n {
+		runs = runs[:n]
+	}
+
+	return runs
+}
+
+// setPaused pauses or resumes polling of the watches, resumed profiles which
+// were marked as booked are checked again. It returns false if nothing has changed.
+func (r *Runner) setPaused(watches []*watch, paused bool) bool {
+	changed := false
+	for _, w := range watches {
+		if !paused && w.profile != nil {
+			r.stateMu.Lock()
+			st := r.notifyState(*w.profile)
+			changed = changed || st.Done
+			st.Done = false
+			r.saveState()
+			r.stateMu.Unlock()
+		}
+		if !w.sched.setPaused(paused) {
+			continue
+		}
+		changed = true
+		if paused {
+			r.stateChanged(w, "paused")
+		} else {
+			r.stateChanged(w, "resumed")
+		}
+	}
+	r.saveSchedulers()
+
+	return changed
+}
+
+// targets returns notifiers of the profile: the targets of the watches
+// of the profile, and the subscribers of the profile.
+// Snoozed notifiers are skipped.
+func (r *Runner) targets(p Profile) []notifier {
+	all := r.allTargets(p)
+
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	now := time.Now()
+	res := all[:0]
+	for _, n := range all {
+		if !r.snoozed(n.id(), now) {
+			res = append(res, n)
+		}
+	}
+
+	return res
+}
+
+func (r *Runner) allTargets(p Profile) []notifier {
+	var res []notifier
+	seen := map[string]bool{}
+	add := func(n notifier) {
+		if !seen[n.id()] {
+			seen[n.id()] = true
+			res = append(res, n)
+		}
+	}
+
+	for _, w := range r.watches {
+		if wp, ok := r.activeProfile(w); ok && wp.key() == p.key() {
+			for _, n := range w.targets {
+				add(n)
+			}
+		}
+	}
+
+	for _, chatID := range r.subs.chatsFor(p) {
+		// the subscriber could be one of the targets
+		add(r.subscriberNotifier(chatID))
+	}
+
+	return res
+}
+
+// operatorTargets are notified about the state of the watch itself.
+func (r *Runner) operatorTargets(w *watch) []notifier {
+	if len(w.targets) > 0 {
+		return w.targets
+	}
+
+	// the subscriptions watch alerts the default recipients
+	return r.notifiers
+}
+
+// pollAll runs the poll loop of each watch until the context is done.
+func (r *Runner) pollAll(ctx context.Context) {
+	for _, w := range r.watches {
+		go r.poll(ctx, w)
+	}
+}
@@ -0,0 +1,129 @@
+package prufen
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// DefaultTelegramWebhookPath is the path the webhook is served at
+	// if the TelegramWebhookURL has none.
+	DefaultTelegramWebhookPath = "/telegram/webhook"
+
+	// webhookSecretHeader carries the secret token given on the webhook registration.
+	webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+// allowedUpdates are the kinds of updates the bot handles.
+var allowedUpdates = []string{"message", "callback_query"}
+
+// parseWebhookURL validates the webhook URL, the DefaultTelegramWebhookPath
+// is used if the URL has no path.
+func parseWebhookURL(webhookURL string) (*url.URL, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("webhook URL %q should be an absolute https URL", webhookURL)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = DefaultTelegramWebhookPath
+	}
+
+	return u, nil
+}
+
+// validateWebhookPath checks that the path of the webhook is not taken
+// by another route, the mux would panic on the registration otherwise.
+func (r *Runner) validateWebhookPath(path string) error {
+	req := &http.Request{Method: http.MethodPost, URL: &url.URL{Path: path}}
+	if _, pattern := r.routes().Handler(req); pattern != "/" {
+		return fmt.Errorf("webhook path %q conflicts with the %q route", path, pattern)
+	}
+
+	return nil
+}
+
+// validWebhookSecret reports whether the secret token consists of
+// the characters allowed by Telegram.
+func validWebhookSecret(secret string) bool {
+	if len(secret) == 0 || len(secret) > 256 {
+		return false
+	}
+	for _, c := range secret {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newWebhookSecret generates a secret token if none is configured,
+// the webhook is re-registered on each start anyway.
+func newWebhookSecret() string {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+
+	return hex.EncodeToString(secret)
+}
+
+// setWebhook registers the webhook URL, the updates are delivered
+// to the HTTP server since then.
+func (r *Runner) setWebhook() error {
+	params := tgbotapi.Params{}
+	params.AddNonEmpty("url", r.webhookURL.String())
+	params.AddNonEmpty("secret_token", r.webhookSecret)
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return err
+	}
+
+	if _, err := r.botClient.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	return nil
+}
+
+// deleteWebhook unregisters the webhook to receive updates by long polling,
+// the pending updates are kept.
+func (r *Runner) deleteWebhook() error {
+	if _, err := r.botClient.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	return nil
+}
+
+// handleWebhook receives the bot updates sent by Telegram.
+func (r *Runner) handleWebhook(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	secret := req.Header.Get(webhookSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(r.webhookSecret)) != 1 {
+		r.logger.Warn("webhook request with invalid secret token", "remote", req.RemoteAddr)
+		writeJSONError(w, http.StatusUnauthorized, "invalid secret token")
+		return
+	}
+
+	var u botUpdate
+	if err := json.NewDecoder(req.Body).Decode(&u); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid update: "+err.Error())
+		return
+	}
+
+	r.handleUpdate(u)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,57 @@
+package prufen
+
+import "testing"
+
+func TestValidateWebhookPath(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{path: DefaultTelegramWebhookPath, ok: true},
+		{path: "/some/secret/path", ok: true},
+		{path: "/metrics"},
+		{path: "/healthz"},
+		{path: "/readyz"},
+		{path: "/api/v1/runs"},
+		{path: "/api/v1/alerts/"},
+		{path: "/api/v1/alerts/hook"},
+		{path: "/api/v1/events"},
+		{path: "/dashboard/"},
+		{path: "/dashboard/hook"},
+	}
+
+	r := &Runner{}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if err := r.validateWebhookPath(tt.path); (err == nil) != tt.ok {
+				t.Errorf("validateWebhookPath() = %v, want ok: %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseWebhookURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		path string
+		ok   bool
+	}{
+		{url: "https://example.com", path: DefaultTelegramWebhookPath, ok: true},
+		{url: "https://example.com/", path: DefaultTelegramWebhookPath, ok: true},
+		{url: "https://example.com/bot/hook", path: "/bot/hook", ok: true},
+		{url: "http://example.com/bot/hook"},
+		{url: "/bot/hook"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := parseWebhookURL(tt.url)
+			if (err == nil) != tt.ok {
+				t.Fatalf("parseWebhookURL() = %v, want ok: %v", err, tt.ok)
+			}
+			if err == nil && u.Path != tt.path {
+				t.Errorf("the path is %q, want %q", u.Path, tt.path)
+			}
+		})
+	}
+}